@@ -10,14 +10,24 @@ import (
 	"time"
 )
 
+// RequestKey is a key for the standard context of a request. Requests whose
+// context has a *http.Request for this key use the values stored for that
+// request, so that they are shared with requests derived from it using
+// Request.WithContext(). The gorilla/mux Router sets it for the requests
+// passed to handlers.
+const RequestKey requestKey = 0
+
+type requestKey int
+
 var (
-	mutex sync.Mutex
+	mutex sync.RWMutex
 	data  = make(map[*http.Request]map[interface{}]interface{})
 	datat = make(map[*http.Request]int64)
 )
 
 // Set stores a value for a given key in a given request.
 func Set(r *http.Request, key, val interface{}) {
+	r = origin(r)
 	mutex.Lock()
 	defer mutex.Unlock()
 	if data[r] == nil {
@@ -29,8 +39,9 @@ func Set(r *http.Request, key, val interface{}) {
 
 // Get returns a value stored for a given key in a given request.
 func Get(r *http.Request, key interface{}) interface{} {
-	mutex.Lock()
-	defer mutex.Unlock()
+	r = origin(r)
+	mutex.RLock()
+	defer mutex.RUnlock()
 	if data[r] != nil {
 		return data[r][key]
 	}
@@ -39,6 +50,7 @@ func Get(r *http.Request, key interface{}) interface{} {
 
 // Delete removes a value stored for a given key in a given request.
 func Delete(r *http.Request, key interface{}) {
+	r = origin(r)
 	mutex.Lock()
 	defer mutex.Unlock()
 	if data[r] != nil {
@@ -51,11 +63,28 @@ func Delete(r *http.Request, key interface{}) {
 // This is usually called by a handler wrapper to clean up request
 // variables at the end of a request lifetime. See ClearHandler().
 func Clear(r *http.Request) {
+	r = origin(r)
+	// Most requests have no values: avoid taking the write lock for them.
+	mutex.RLock()
+	_, ok := datat[r]
+	mutex.RUnlock()
+	if !ok {
+		return
+	}
 	mutex.Lock()
 	defer mutex.Unlock()
 	clear(r)
 }
 
+// origin returns the request whose values are used for a request.
+// See RequestKey.
+func origin(r *http.Request) *http.Request {
+	if o, _ := r.Context().Value(RequestKey).(*http.Request); o != nil {
+		return o
+	}
+	return r
+}
+
 // clear is Clear without the lock.
 func clear(r *http.Request) {
 	delete(data, r)
@@ -5,6 +5,7 @@
 package context
 
 import (
+	stdcontext "context"
 	"net/http"
 	"testing"
 )
@@ -49,4 +50,13 @@ func TestContext(t *testing.T) {
 	// Clear()
 	Clear(r)
 	assertEqual(len(data), 0)
+
+	// Derived requests.
+	Set(r, key1, "1")
+	derived := r.WithContext(stdcontext.WithValue(r.Context(), RequestKey, r))
+	assertEqual(Get(derived, key1), "1")
+	Set(derived, key2, "2")
+	assertEqual(Get(r, key2), "2")
+	Clear(derived)
+	assertEqual(len(data), 0)
 }
@@ -74,7 +74,10 @@ served. Just call Clear() passing the request:
 ...or use ClearHandler(), which conveniently wraps an http.Handler to clear
 variables at the end of a request lifetime.
 
-The Router from the package gorilla/mux calls Clear(), so if you are using it
-you don't need to clear the context manually.
+The Router from the package gorilla/mux calls Clear() at the end of each
+request, so if you are using it you don't need to clear the context
+manually. The router passes a copy of the request to handlers, as it stores
+route variables in the standard request context, but the copy shares the
+values of the original request. See RequestKey.
 */
 package context
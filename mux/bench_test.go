@@ -5,6 +5,7 @@
 package mux
 
 import (
+	"fmt"
 	"net/http"
 	"testing"
 )
@@ -19,3 +20,84 @@ func BenchmarkMux(b *testing.B) {
 		router.ServeHTTP(nil, request)
 	}
 }
+
+func BenchmarkMux10(b *testing.B) {
+	benchmarkRoutes(b, 10)
+}
+
+func BenchmarkMux100(b *testing.B) {
+	benchmarkRoutes(b, 100)
+}
+
+func BenchmarkMux1000(b *testing.B) {
+	benchmarkRoutes(b, 1000)
+}
+
+// benchmarkRoutes registers n routes with static and variable segments and
+// dispatches a request to the last one, which is the worst case for a
+// linear scan.
+func benchmarkRoutes(b *testing.B, n int) {
+	router := NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	for i := 0; i < n; i++ {
+		switch i % 3 {
+		case 0:
+			router.HandleFunc(fmt.Sprintf("/api/res%d", i), handler)
+		case 1:
+			router.HandleFunc(fmt.Sprintf("/api/res%d/{id}", i), handler)
+		case 2:
+			router.HandleFunc(fmt.Sprintf("/api/res%d/{id:[0-9]+}/items", i), handler)
+		}
+	}
+	var url string
+	switch (n - 1) % 3 {
+	case 0:
+		url = fmt.Sprintf("/api/res%d", n-1)
+	case 1:
+		url = fmt.Sprintf("/api/res%d/42", n-1)
+	case 2:
+		url = fmt.Sprintf("/api/res%d/42/items", n-1)
+	}
+	request, _ := http.NewRequest("GET", url, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(nil, request)
+	}
+}
+
+// BenchmarkMuxVars dispatches a request to a route with host, path and
+// query variables, some of them matched with regexps.
+func BenchmarkMuxVars(b *testing.B) {
+	router := NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/articles", handler)
+	s := router.Host("{subdomain}.domain.com").Subrouter()
+	s.HandleFunc("/articles/{category}/{id:[0-9]+}", handler).
+		Queries("page", "{page:[0-9]+}")
+
+	request, _ := http.NewRequest("GET", "http://www.domain.com/articles/go/42?page=2", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(nil, request)
+	}
+}
+
+// BenchmarkMuxParallel dispatches requests from several goroutines, to show
+// the cost of the locks taken for each request.
+func BenchmarkMuxParallel(b *testing.B) {
+	router := NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/articles", handler)
+	router.HandleFunc("/articles/{category}/{id:[0-9]+}", handler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		request, _ := http.NewRequest("GET", "http://localhost/articles/go/42", nil)
+		for pb.Next() {
+			router.ServeHTTP(nil, request)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions defines a Cross-Origin Resource Sharing policy.
+// See Router.CORS().
+type CORSOptions struct {
+	// Origins allowed to make requests, e.g. "https://www.domain.com".
+	// The value "*" allows any origin, but without credentials: origins
+	// allowed only by it never get AllowCredentials.
+	AllowedOrigins []string
+	// Request headers allowed in requests, besides the simple ones.
+	AllowedHeaders []string
+	// Response headers exposed to the client, besides the simple ones.
+	ExposedHeaders []string
+	// If true, requests from origins listed in AllowedOrigins can include
+	// credentials like cookies.
+	AllowCredentials bool
+	// How long the response to a preflight request can be cached. It is
+	// not sent if zero.
+	MaxAge time.Duration
+}
+
+// CORS sets the Cross-Origin Resource Sharing policy for the routes of the
+// router. Subrouters use the policy of their parent router unless they set
+// their own. The policy is off by default. For example:
+//
+//     r := mux.NewRouter()
+//     api := r.PathPrefix("/api").Subrouter()
+//     api.CORS(&mux.CORSOptions{
+//         AllowedOrigins: []string{"https://www.domain.com"},
+//         AllowedHeaders: []string{"Authorization"},
+//     })
+//
+// When a policy is set, OPTIONS requests are answered automatically for
+// paths that have routes for other methods: the response lists the methods
+// registered for the path in the Allow header and, for preflight requests
+// from allowed origins, in the Access-Control-Allow-Methods header.
+// Preflight requests for routes without Methods(), which match any method,
+// are answered as well, allowing the requested method. Routes registered
+// for the OPTIONS method still take precedence.
+//
+// Responses to other requests from allowed origins get the
+// Access-Control-Allow-Origin header and related ones. All responses get
+// "Vary: Origin", as they depend on the origin of the request.
+func (r *Router) CORS(opts *CORSOptions) *Router {
+	r.cors = opts
+	return r
+}
+
+// getCORS returns the CORS policy for the router, if any.
+func (r *Router) getCORS() *CORSOptions {
+	if r.cors == nil && r.parent != nil {
+		return r.parent.getCORS()
+	}
+	return r.cors
+}
+
+// allowOrigin returns the value for the Access-Control-Allow-Origin header
+// for a request, or an empty string if the origin is not allowed.
+func (c *CORSOptions) allowOrigin(req *http.Request) string {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+	wildcard := false
+	for _, v := range c.AllowedOrigins {
+		if v == origin {
+			return origin
+		}
+		wildcard = wildcard || v == "*"
+	}
+	if wildcard {
+		// Browsers don't send credentials for the wildcard.
+		return "*"
+	}
+	return ""
+}
+
+// setOriginHeaders sets the headers common to all responses for an allowed
+// origin. It returns false if the origin is not allowed.
+func (c *CORSOptions) setOriginHeaders(w http.ResponseWriter, req *http.Request) bool {
+	origin := c.allowOrigin(req)
+	if origin == "" {
+		return false
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials && origin != "*" {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// setHeaders sets the CORS headers for an actual request.
+func (c *CORSOptions) setHeaders(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	if c.setOriginHeaders(w, req) && len(c.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers",
+			strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// preflight answers an OPTIONS request for a path that has routes for the
+// given methods. If methods is nil, the path has a route for any method.
+func (c *CORSOptions) preflight(w http.ResponseWriter, req *http.Request, methods []string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	method := req.Header.Get("Access-Control-Request-Method")
+	allow := method
+	if methods != nil {
+		allow = strings.Join(methods, ", ")
+		if !matchInArray(methods, "OPTIONS") {
+			allow += ", OPTIONS"
+		}
+		h.Set("Allow", allow)
+	}
+	if method != "" && (methods == nil || matchInArray(methods, method)) &&
+		c.allowHeaders(req) && c.setOriginHeaders(w, req) {
+		h.Set("Access-Control-Allow-Methods", allow)
+		if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age",
+				strconv.Itoa(int(c.MaxAge/time.Second)))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isPreflight returns true if the request is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowHeaders returns true if all headers requested in a preflight request
+// are allowed.
+func (c *CORSOptions) allowHeaders(req *http.Request) bool {
+	headers := req.Header.Get("Access-Control-Request-Headers")
+	for _, v := range strings.Split(headers, ",") {
+		v = http.CanonicalHeaderKey(strings.TrimSpace(v))
+		if v == "" || matchInArray(simpleHeaders, v) {
+			continue
+		}
+		allowed := false
+		for _, a := range c.AllowedHeaders {
+			if http.CanonicalHeaderKey(a) == v {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// simpleHeaders are the request headers always allowed by CORS.
+var simpleHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Content-Language",
+	"Content-Type",
+}
@@ -0,0 +1,180 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := NewRouter()
+	r.HandleFunc("/public", handler).Methods("GET")
+	api := r.PathPrefix("/api").Subrouter()
+	api.CORS(&CORSOptions{
+		AllowedOrigins:   []string{"https://www.domain.com"},
+		AllowedHeaders:   []string{"authorization"},
+		ExposedHeaders:   []string{"X-Total-Count"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	api.HandleFunc("/items", handler).Methods("GET", "POST")
+	api.HandleFunc("/items", handler).Methods("PUT")
+	api.HandleFunc("/any", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	api.HandleFunc("/custom", handler).Methods("GET")
+	api.HandleFunc("/custom", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods("OPTIONS")
+	open := api.PathPrefix("/open").Subrouter()
+	open.CORS(&CORSOptions{AllowedOrigins: []string{"*"}})
+	open.HandleFunc("/items", handler).Methods("GET")
+	mixed := r.PathPrefix("/mixed").Subrouter()
+	mixed.CORS(&CORSOptions{AllowedOrigins: []string{"*", "https://www.domain.com"}, AllowCredentials: true})
+	mixed.HandleFunc("/items", handler).Methods("GET")
+
+	tests := []struct {
+		method  string
+		url     string
+		headers map[string]string
+		status  int
+		expect  map[string]string
+	}{
+		// Preflight.
+		{
+			"OPTIONS", "/api/items",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "Authorization, Content-Type"},
+			http.StatusNoContent,
+			map[string]string{
+				"Allow":                            "GET, POST, PUT, OPTIONS",
+				"Access-Control-Allow-Origin":      "https://www.domain.com",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT, OPTIONS",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin",
+			},
+		},
+		// Preflight from an origin that is not allowed.
+		{
+			"OPTIONS", "/api/items",
+			map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": "PUT"},
+			http.StatusNoContent,
+			map[string]string{"Allow": "GET, POST, PUT, OPTIONS", "Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		// Preflight for a method that is not registered.
+		{
+			"OPTIONS", "/api/items",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "DELETE"},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		// Preflight with a header that is not allowed.
+		{
+			"OPTIONS", "/api/items",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Foo"},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		// Plain OPTIONS request.
+		{
+			"OPTIONS", "/api/items", nil,
+			http.StatusNoContent,
+			map[string]string{"Allow": "GET, POST, PUT, OPTIONS"},
+		},
+		// Route without methods.
+		{
+			"OPTIONS", "/api/any",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "DELETE"},
+			http.StatusNoContent,
+			map[string]string{"Allow": "", "Access-Control-Allow-Origin": "https://www.domain.com", "Access-Control-Allow-Methods": "DELETE", "Vary": "Origin"},
+		},
+		{
+			"OPTIONS", "/api/any", nil,
+			http.StatusAccepted,
+			map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		// Explicit OPTIONS route.
+		{
+			"OPTIONS", "/api/custom",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "GET"},
+			http.StatusTeapot,
+			map[string]string{"Access-Control-Allow-Origin": "https://www.domain.com", "Access-Control-Allow-Methods": ""},
+		},
+		// Actual request.
+		{
+			"GET", "/api/items",
+			map[string]string{"Origin": "https://www.domain.com"},
+			http.StatusOK,
+			map[string]string{
+				"Access-Control-Allow-Origin":      "https://www.domain.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total-Count",
+			},
+		},
+		{
+			"GET", "/api/items",
+			map[string]string{"Origin": "https://evil.com"},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		// Subrouter with its own policy.
+		{
+			"GET", "/api/open/items",
+			map[string]string{"Origin": "https://evil.com"},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": "", "Vary": "Origin"},
+		},
+		// The wildcard never allows credentials.
+		{
+			"GET", "/mixed/items",
+			map[string]string{"Origin": "https://evil.com"},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			"GET", "/mixed/items",
+			map[string]string{"Origin": "https://www.domain.com"},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "https://www.domain.com", "Access-Control-Allow-Credentials": "true"},
+		},
+		// No policy.
+		{
+			"OPTIONS", "/public",
+			map[string]string{"Origin": "https://www.domain.com", "Access-Control-Request-Method": "GET"},
+			http.StatusMethodNotAllowed,
+			map[string]string{"Allow": "GET", "Access-Control-Allow-Origin": ""},
+		},
+		{
+			"GET", "/public",
+			map[string]string{"Origin": "https://www.domain.com"},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+	}
+	for i, test := range tests {
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.url, nil)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rsp := NewRecorder()
+		r.ServeHTTP(rsp, req)
+		status := rsp.Code
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status != test.status {
+			t.Errorf("(%v) %s %s: expected status %v, got %v", i, test.method, test.url, test.status, status)
+		}
+		for k, v := range test.expect {
+			if got := rsp.HeaderMap.Get(k); got != v {
+				t.Errorf("(%v) %s %s: expected header %s %q, got %q", i, test.method, test.url, k, v, got)
+			}
+		}
+	}
+}
@@ -53,6 +53,48 @@ calling mux.Vars():
 	vars := mux.Vars(request)
 	category := vars["category"]
 
+The variables are stored in the context of the request given to the handler,
+so they are kept in requests derived from it with Request.WithContext(). To
+test a handler without a router, set the variables with mux.SetURLVars():
+
+	req = mux.SetURLVars(req, map[string]string{"category": "go"})
+
+Instead of a regular expression, a variable can use a named pattern. The
+patterns "int", "uuid" and "date" are available by default, and more can be
+registered calling Router.Pattern(). Patterns can also convert the values
+they match:
+
+	r.HandleFunc("/articles/{id:int}", ArticleHandler)
+
+	// In ArticleHandler.
+	id, ok := mux.VarInt(request, "id")
+
+Paths are matched after they are decoded, so an escaped slash ("%2F") can't
+be part of a variable value. Call Router.UseEncodedPath(true) to match the
+encoded path instead; variables are decoded after they are extracted:
+
+	r := mux.NewRouter().UseEncodedPath(true)
+	// "/objects/a%2Fb" matches, and the "key" variable is "a/b".
+	r.HandleFunc("/objects/{key}", ObjectHandler)
+
+Requests for paths with "." or ".." segments or repeated slashes are
+redirected to the cleaned path. Call Router.SkipClean(true) to match them
+as they are.
+
+Likewise, routes created after calling Router.StrictSlash(true) match paths
+with or without a trailing slash and redirect them to the route path. The
+redirects keep the query string and use "301 Moved Permanently" for GET and
+HEAD requests, or "308 Permanent Redirect" to keep the method of other
+requests. Router.PathPolicy() changes this for a router and its subrouters:
+
+	// Serve "/users" and "/users/" with the same handler, without redirects.
+	r := mux.NewRouter().StrictSlash(true).PathPolicy(mux.PathServe)
+	r.HandleFunc("/users/", UsersHandler)
+
+The other policies are PathRedirectTemporary, to redirect with 302 or 307,
+and PathNotFound, to only match the path as it is: a path that isn't clean
+gets a 404 unless a route matches it.
+
 And this is all you need to know about the basic usage. More advanced options
 are explained below.
 
@@ -65,6 +107,14 @@ pattern to be matched. They can also have variables:
 	// Matches a dynamic subdomain.
 	r.Host("{subdomain:[a-z]+}.domain.com")
 
+The port of the request is ignored, unless the host template has one. Then
+it must match as well:
+
+	// Only matches if the port is 8080.
+	r.Host("www.domain.com:8080")
+	// Matches any port, stored in the "port" variable.
+	r.Host("www.domain.com:{port}")
+
 There are several other matchers that can be added. To match path prefixes:
 
 	r.PathPrefix("/products/")
@@ -73,6 +123,12 @@ There are several other matchers that can be added. To match path prefixes:
 
 	r.Methods("GET", "POST")
 
+When a request matches a route in everything but its method, the router
+answers "405 Method Not Allowed" and lists the accepted methods in the Allow
+header. Set Router.MethodNotAllowedHandler to customize this response.
+Call Router.AutoHead(true) to serve HEAD requests with the GET routes when
+no route matches them: the headers are sent and the body is discarded.
+
 ...or URL schemes:
 
 	r.Schemes("https")
@@ -85,6 +141,21 @@ There are several other matchers that can be added. To match path prefixes:
 
 	r.Queries("key", "value")
 
+Query values can also have variables, extracted like the ones in the path and
+added to the query string of URLs built for the route:
+
+	r.Queries("page", "{page:[0-9]+}")
+
+...or media types accepted by the client or sent in the request body:
+
+	r.Accepts("application/json", "text/html")
+	r.Consumes("application/json")
+
+When several routes with the same host and path templates use Accepts(), the
+one with the best quality value for the Accept header of the request is chosen. If no route
+accepts the media types of the request, the response is "406 Not Acceptable"
+or "415 Unsupported Media Type".
+
 ...or to use a custom matcher function:
 
 	r.MatcherFunc(myFunc)
@@ -134,6 +205,46 @@ the inner routes use it as base for their paths:
 	// "/products/{key}/details"
 	s.HandleFunc("/{key}/details"), ProductDetailsHandler)
 
+Routers can also wrap the handlers of matched routes with middlewares. A
+middleware is a function that receives an http.Handler and returns another
+one. Subrouters apply the middlewares of their parent routers first, then
+their own:
+
+	r := mux.NewRouter()
+	r.Use(loggingMiddleware)
+	s := r.PathPrefix("/admin").Subrouter()
+	s.Use(authMiddleware)
+
+Middlewares only run when a route matches, so mux.Vars() and
+mux.CurrentRoute() are available to them.
+
+To collect metrics by route, set an instrumentation function. It is called
+after each request with the matched route, the status code, the length of
+the response body and the duration. The package
+code.google.com/p/gorilla/mux/muxexpvar publishes them through expvar:
+
+	r.Instrument(muxexpvar.NewCollector("routes").Observe)
+
+Routes can carry metadata for middlewares, like the authorization scopes
+they require. Routes inherit the metadata of their parent routes and
+subrouters, and can override it:
+
+	s := r.PathPrefix("/admin").Subrouter().Meta("scope", "admin")
+	s.HandleFunc("/users", UsersHandler)
+
+	// In authMiddleware: "admin" for "/admin/users".
+	scope := mux.CurrentRoute(request).GetMeta("scope")
+
+Routers and subrouters can also have a Cross-Origin Resource Sharing policy.
+When it is set, OPTIONS and preflight requests are answered automatically
+using the methods registered for the path, and responses to allowed origins
+get the proper Access-Control-* headers:
+
+	api := r.PathPrefix("/api").Subrouter()
+	api.CORS(&mux.CORSOptions{
+		AllowedOrigins: []string{"https://www.domain.com"},
+	})
+
 Now let's see how to build registered URLs.
 
 Routes can be named. All routes that define a name can have their URLs built,
@@ -193,5 +304,109 @@ as well:
 	url, err := r.Get("article").URL("subdomain", "news",
 									 "category", "technology",
 									 "id", "42")
+
+Route names are shared by all subrouters. To avoid clashes between groups of
+routes, a subrouter can prefix the names of its routes. Subrouters can also
+set schemes and headers for all their new routes:
+
+	admin := r.PathPrefix("/admin").Subrouter().
+		NamePrefix("admin.").
+		DefaultSchemes("https").
+		StrictSlash(true)
+	admin.HandleFunc("/users/", UsersHandler).Name("users")
+
+	// Both return the route named "admin.users".
+	route := r.Get("admin.users")
+	route = admin.Get("users")
+
+The URL scheme is the first one defined with Schemes(), or "http" if none is.
+Extra query values can be added using URLQuery():
+
+	// "http://news.domain.com/articles/technology/42?page=2"
+	url, err := r.Get("article").URLQuery(url.Values{"page": {"2"}},
+		"subdomain", "news", "category", "technology", "id", "42")
+
+To build links for emails or redirects, AbsoluteURL() takes the scheme and
+host from the current request when the route doesn't define them:
+
+	r.HandleFunc("/confirm/{token}", ConfirmHandler).Name("confirm")
+
+	// "https://www.domain.com/confirm/abc" for a TLS request to www.domain.com
+	url, err := r.Get("confirm").AbsoluteURL(req, "token", "abc")
+
+Behind a reverse proxy, call Router.TrustProxyHeaders(true) to use the
+X-Forwarded-Proto and X-Forwarded-Host headers set by the proxy instead.
+
+Router.FuncMap() returns functions to build URLs in templates: "url",
+"urlpath" and "absurl", which takes the current request first:
+
+	t := template.New("page").Funcs(r.FuncMap())
+	t.Parse(`<a href="{{url "article" "category" .Cat "id" .ID}}">`)
+
+To redirect old URLs to a named route, call Route.RedirectTo(). The URL is
+built with the variables of the matched request, and the query string is
+kept:
+
+	// "/blog/go/42?page=2" is redirected to "/articles/go/42?page=2".
+	r.Path("/blog/{category}/{id:[0-9]+}").
+		RedirectTo("article", http.StatusMovedPermanently)
+
+Route.RedirectToFunc() does the same, with a function that maps the
+variables of the request to the ones of the target route.
+
+Registered routes can also be inspected. Router.Walk() visits every route,
+including the ones registered in subrouters, and routes provide methods to
+read their definitions:
+
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err == nil {
+			fmt.Println(route.GetName(), tpl)
+		}
+		return nil
+	})
+
+The package code.google.com/p/gorilla/mux/openapi uses this to generate an
+OpenAPI document describing the registered routes.
+
+The package code.google.com/p/gorilla/mux/muxtest checks routes with tables
+of requests and the routes they should match:
+
+	muxtest.Check(t, r, []muxtest.Case{
+		{URL: "/articles/go/42", Route: "article", Vars: map[string]string{"id": "42"}},
+		{Method: "POST", URL: "/x"}, // Doesn't match.
+	})
+
+Router.Validate() reports routes with errors, route names used more than
+once and routes that can never match because an earlier route matches all
+their requests. It is useful in tests or at startup:
+
+	if errs := r.Validate(); errs != nil {
+		log.Fatal(errs)
+	}
+
+To find out why a request doesn't match a route, Router.Explain() tells for
+every route if it matches the request and, if not, which matcher rejected it:
+
+	for _, e := range r.Explain(req) {
+		log.Println(e) // e.g. `users: method "POST" is not one of GET, HEAD`
+	}
+
+Routes must not be changed once the router is serving requests. To add,
+remove or replace routes at runtime, for example to load plugins, create the
+route with Router.DetachedRoute() and register it with Router.AddRoute() or
+Router.ReplaceRoute(). Router.RemoveRoute() removes a route, and
+Router.SetHandler() replaces the handler of a named route:
+
+	route := r.DetachedRoute().Path("/plugins/foo").Handler(fooHandler).Name("foo")
+	if err := r.AddRoute(route); err != nil {
+		// ...
+	}
+	r.SetHandler("foo", newFooHandler)
+	r.RemoveRoute(route)
+
+These methods are safe to call concurrently with requests: the routes are
+kept in a table that is replaced as a whole, and requests being matched keep
+using the previous one. Handlers are replaced atomically in the same route.
 */
 package mux
@@ -0,0 +1,107 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RouteExplanation tells if a route matches a request and, if not, why.
+// See Router.Explain().
+type RouteExplanation struct {
+	// The explained route.
+	Route *Route
+	// The routes leading to the router where the route was registered,
+	// starting from the outermost one. See WalkFunc.
+	Ancestors []*Route
+	// True if the route matches the request.
+	Matched bool
+	// Why the route doesn't match, from the first matcher that rejected
+	// the request. Empty if the route matches.
+	Reason string
+}
+
+// String returns the route name, or its path or host template if it has no
+// name, followed by the explanation.
+func (e RouteExplanation) String() string {
+	name := e.Route.Label()
+	if e.Matched {
+		return fmt.Sprintf("%s: matched", name)
+	}
+	return fmt.Sprintf("%s: %s", name, e.Reason)
+}
+
+// Explain tells, for every route of the router and its subrouters, if it
+// matches the request and, if not, which matcher rejected it. It is meant
+// to debug routes, for example when a request unexpectedly gets a 404:
+//
+//     for _, e := range r.Explain(req) {
+//         log.Println(e)
+//     }
+//
+// Routes are listed in the order they are visited by Router.Walk(). The
+// first route that matches is the one that handles the request, unless it
+// uses Route.Accepts(): then the following routes with the same host and
+// path templates that match as well compete for it, and the one with the
+// best quality value for the Accept header wins. See Router.Match(). A route
+// with a subrouter matches only if one of the routes in the subrouter does,
+// and routes in a subrouter don't match if their parent route rejected the
+// request.
+//
+// Custom matchers are called again, so they shouldn't have side effects.
+func (r *Router) Explain(req *http.Request) []RouteExplanation {
+	var explanations []RouteExplanation
+	// Reasons why the ancestor routes rejected the request, ignoring their
+	// subrouters.
+	reasons := make(map[*Route]string)
+	r.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		e := RouteExplanation{Route: route, Ancestors: ancestors}
+		for _, a := range ancestors {
+			if reason := reasons[a]; reason != "" {
+				e.Reason = "parent route: " + reason
+				break
+			}
+		}
+		if e.Reason == "" {
+			e.Reason = route.explainMatch(req, true)
+		}
+		reasons[route] = route.explainMatch(req, false)
+		e.Matched = e.Reason == ""
+		explanations = append(explanations, e)
+		return nil
+	})
+	return explanations
+}
+
+// explainMatch returns why the route doesn't match the request, or an empty
+// string if it matches. If sub is false, subrouters are not tested.
+func (r *Route) explainMatch(req *http.Request, sub bool) string {
+	if r.buildOnly {
+		return "the route is build-only"
+	}
+	if r.err != nil {
+		return "the route has an error: " + r.err.Error()
+	}
+	for _, m := range r.matchers {
+		if _, ok := m.(*Router); ok && !sub {
+			continue
+		}
+		if !m.Match(req, &RouteMatch{noMiddlewares: true}) {
+			return m.explain(req)
+		}
+	}
+	match := &RouteMatch{Vars: make(map[string]string)}
+	if r.regexp != nil {
+		return r.regexp.setMatch(req, match, r)
+	}
+	return ""
+}
+
+// explain tells why a subrouter used as a matcher rejected the request. The
+// reasons for each of its routes are given by Router.Explain().
+func (r *Router) explain(req *http.Request) string {
+	return "no route in the subrouter matched"
+}
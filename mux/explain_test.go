@@ -0,0 +1,118 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	r := NewRouter()
+	r.Path("/articles/{id:[0-9]+}").Name("article")
+	r.PathPrefix("/static/")
+	r.Path("/users").Methods("GET", "HEAD").Name("users")
+	r.Path("/users").Schemes("https").Name("secure")
+	r.Path("/users").Headers("X-Requested-With", "XMLHttpRequest", "X-Api", "").Name("ajax")
+	r.Path("/users").Queries("page", "{page:[0-9]+}").Name("paged")
+	r.Path("/users").MatcherFunc(func(*http.Request, *RouteMatch) bool { return false }).Name("func")
+	r.Path("/users/{id:int}").Name("typed")
+	r.Path("/users").BuildOnly().Name("build")
+	s := r.Host("api.domain.com").Subrouter()
+	s.Path("/users").Name("api.users")
+	r.Path("/users").Name("users.any")
+
+	req, _ := http.NewRequest("POST", "http://www.domain.com/users?page=x", nil)
+	req.Header.Set("X-Requested-With", "Fetch")
+	expected := []string{
+		`article: path "/users" doesn't match the template "/articles/{id:[0-9]+}"`,
+		`/static/: path "/users" doesn't match the prefix template "/static/"`,
+		`users: method "POST" is not one of GET, HEAD`,
+		`secure: scheme "http" is not one of https`,
+		`ajax: header "X-Api" is missing`,
+		`paged: query values ["x"] for "page" don't match the template "{page:[0-9]+}"`,
+		`func: custom matcher function returned false`,
+		`typed: path "/users" doesn't match the template "/users/{id:int}"`,
+		`build: the route is build-only`,
+		`api.domain.com: host "www.domain.com" doesn't match the template "api.domain.com"`,
+		`api.users: parent route: host "www.domain.com" doesn't match the template "api.domain.com"`,
+		`users.any: matched`,
+	}
+	explanations := r.Explain(req)
+	if len(explanations) != len(expected) {
+		t.Fatalf("Expected %d explanations, got %d: %v", len(expected), len(explanations), explanations)
+	}
+	for i, e := range explanations {
+		if e.String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], e.String())
+		}
+		if e.Matched != (e.Reason == "") {
+			t.Errorf("%v: inconsistent Matched and Reason", e)
+		}
+	}
+	if a := explanations[10].Ancestors; len(a) != 1 || a[0] != explanations[9].Route {
+		t.Errorf("Expected the host route as ancestor, got %v", a)
+	}
+
+	req, _ = http.NewRequest("GET", "http://api.domain.com/users/abc", nil)
+	explanations = r.Explain(req)
+	if e := explanations[7]; e.Matched || e.Reason != `path "/users/abc" doesn't match the template "/users/{id:int}"` {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+	if e := explanations[9]; e.Matched || e.Reason != "no route in the subrouter matched" {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+	if e := explanations[10]; e.Matched || e.Reason != `path "/users/abc" doesn't match the template "/users"` {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+
+	// Values rejected by converters.
+	r = NewRouter()
+	r.Path("/items/{id:int}").Name("item")
+	req, _ = http.NewRequest("GET", "http://localhost/items/99999999999999999999999", nil)
+	if e := r.Explain(req)[0]; e.Matched || e.Reason != "a variable value was rejected by its named pattern" {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+
+	// Other reasons for variables.
+	r = NewRouter().UseEncodedPath(true).StrictSlash(true).PathPolicy(PathNotFound)
+	r.Path("/f/{key:[^/]{2}}{rest}")
+	r.Path("/dirs/{key}/")
+	req, _ = http.NewRequest("GET", "http://localhost/f/%2Fx", nil)
+	if e := r.Explain(req)[0]; e.Matched || e.Reason != "a variable value has an invalid escape sequence" {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost/dirs/a", nil)
+	if e := r.Explain(req)[1]; e.Matched || e.Reason != "the path differs by the trailing slash and the policy is PathNotFound" {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+
+	// Routes competing for the media type both match.
+	r = NewRouter()
+	r.Path("/articles").Accepts("application/json").Name("json")
+	r.Path("/articles").Accepts("text/html").Name("html")
+	req, _ = http.NewRequest("GET", "http://localhost/articles", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, text/html")
+	if e := r.Explain(req); len(e) != 2 || !e[0].Matched || !e[1].Matched {
+		t.Errorf("Unexpected explanations: %v", e)
+	}
+	var m RouteMatch
+	if !r.Match(req, &m) || m.Route != r.Get("html") {
+		t.Errorf("Expected the route with the best quality value to win")
+	}
+
+	// Middlewares of subrouters are not applied.
+	r = NewRouter()
+	s = r.PathPrefix("/api").Subrouter()
+	s.Use(func(h http.Handler) http.Handler {
+		t.Errorf("Unexpected middleware call")
+		return h
+	})
+	s.Path("/users").Handler(http.NotFoundHandler())
+	req, _ = http.NewRequest("GET", "http://localhost/api/users", nil)
+	if e := r.Explain(req)[0]; !e.Matched {
+		t.Errorf("Unexpected explanation: %v", e)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// FuncMap returns template functions to build URLs for the named routes of
+// the router:
+//
+// - url: the URL for a route, like Route.URL();
+//
+// - urlpath: only the path, like Route.URLPath();
+//
+// - absurl: an absolute URL taking the scheme and host from the request
+// given as first argument, like Route.AbsoluteURL().
+//
+// They take the route name followed by the variable names and values. The
+// values can be of any type, as with Route.TypedURL(). For example:
+//
+//     t := template.New("page").Funcs(r.FuncMap())
+//     t.Parse(`<a href="{{url "article" "category" .Cat "id" .ID}}">`)
+//
+//     t.Parse(`<link rel="canonical" href="{{absurl .Request "article" "id" .ID}}">`)
+//
+// If the route doesn't exist or its URL can't be built, the template
+// execution fails with the error. The route names are prefixed by the name
+// prefix of the router, as in Router.Get().
+func (r *Router) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"url": func(name string, pairs ...interface{}) (string, error) {
+			return r.funcURL(name, pairs, func(route *Route,
+				s []string) (*url.URL, error) {
+				return route.URL(s...)
+			})
+		},
+		"urlpath": func(name string, pairs ...interface{}) (string, error) {
+			return r.funcURL(name, pairs, func(route *Route,
+				s []string) (*url.URL, error) {
+				return route.URLPath(s...)
+			})
+		},
+		"absurl": func(req *http.Request, name string,
+			pairs ...interface{}) (string, error) {
+			return r.funcURL(name, pairs, func(route *Route,
+				s []string) (*url.URL, error) {
+				return route.AbsoluteURL(req, s...)
+			})
+		},
+	}
+}
+
+// funcURL returns the URL built by f for the named route, given the typed
+// values of the variables.
+func (r *Router) funcURL(name string, pairs []interface{},
+	f func(*Route, []string) (*url.URL, error)) (string, error) {
+	route := r.Get(name)
+	if route == nil {
+		return "", fmt.Errorf("mux: route %q not found", name)
+	}
+	s, err := route.stringPairs(pairs)
+	if err != nil {
+		return "", err
+	}
+	u, err := f(route, s)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
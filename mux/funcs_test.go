@@ -0,0 +1,55 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFuncMap(t *testing.T) {
+	r := NewRouter()
+	r.Host("www.domain.com").Path("/articles/{category}/{id:int}").
+		Queries("lang", "{lang}").Name("article")
+	r.Path("/users/{name}").Name("user")
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	data := map[string]interface{}{
+		"Request": req,
+		"Cat":     "a b",
+		"ID":      42,
+	}
+
+	tests := []struct {
+		tpl      string
+		expected string
+		err      string
+	}{
+		{`{{url "article" "category" .Cat "id" .ID "lang" "en"}}`,
+			`http://www.domain.com/articles/a%20b/42?lang=en`, ""},
+		{`<a href="{{url "article" "category" .Cat "id" .ID "lang" "en"}}">`,
+			`<a href="http://www.domain.com/articles/a%20b/42?lang=en">`, ""},
+		{`{{urlpath "article" "category" "go" "id" 7}}`, `/articles/go/7`, ""},
+		{`{{absurl .Request "user" "name" "joe"}}`, `http://localhost:8080/users/joe`, ""},
+		{`{{url "missing"}}`, "", `mux: route "missing" not found`},
+		{`{{url "user"}}`, "", `mux: missing route variable "name"`},
+		{`{{url "article" "category" "go" "id" "x" "lang" "en"}}`, "", `doesn't match`},
+		{`{{url "user" "name"}}`, "", `multiple of 2`},
+	}
+	for _, test := range tests {
+		tpl := template.Must(template.New("").Funcs(r.FuncMap()).Parse(test.tpl))
+		var buf bytes.Buffer
+		err := tpl.Execute(&buf, data)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.tpl, test.err, err)
+			}
+		} else if err != nil || buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q and error %v", test.tpl, test.expected, buf.String(), err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter discards the body of the responses to HEAD requests
+// served by GET routes. See Router.AutoHead().
+//
+// The status code is only written when the handler returns or flushes the
+// response, so that Content-Length can be set to the length of the body.
+type headResponseWriter struct {
+	http.ResponseWriter
+	// Status code set by the handler, or zero.
+	status int
+	// Length of the discarded body.
+	length int
+	// True once the header was written to the underlying writer.
+	wroteHeader bool
+}
+
+// WriteHeader keeps the status code until the header is written.
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write discards the body, counting its length.
+func (w *headResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.length += len(p)
+	return len(p), nil
+}
+
+// Flush writes the header, without Content-Length, and flushes it.
+func (w *headResponseWriter) Flush() {
+	w.writeHeader(false)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection, if the underlying writer supports it. The
+// header is not written then.
+func (w *headResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the header with the Content-Length of the discarded body,
+// once the handler returns.
+func (w *headResponseWriter) finish() {
+	w.writeHeader(true)
+}
+
+// writeHeader writes the header, if it wasn't written yet.
+func (w *headResponseWriter) writeHeader(length bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if length && h.Get("Content-Length") == "" && bodyAllowed(w.status) {
+		h.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// bodyAllowed returns true if a response with the status code can have a
+// body.
+func bodyAllowed(status int) bool {
+	return (status < 100 || status > 199) && status != http.StatusNoContent &&
+		status != http.StatusNotModified
+}
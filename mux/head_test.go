@@ -0,0 +1,107 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestAutoHead(t *testing.T) {
+	var method string
+	r := NewRouter().AutoHead(true)
+	r.HandleFunc("/health", func(w http.ResponseWriter, req *http.Request) {
+		method = req.Method
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}).Methods("GET")
+	r.HandleFunc("/head", func(w http.ResponseWriter, req *http.Request) {
+		method = "explicit " + req.Method
+		w.Header().Set("Content-Length", "42")
+	}).Methods("HEAD")
+	r.HandleFunc("/head", func(w http.ResponseWriter, req *http.Request) {
+		method = req.Method
+	}).Methods("GET")
+	r.HandleFunc("/empty/{id}", func(w http.ResponseWriter, req *http.Request) {
+		method = req.Method + " " + Vars(req)["id"]
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("GET")
+	r.HandleFunc("/stream", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("chunk"))
+	}).Methods("GET")
+	r.HandleFunc("/post", func(w http.ResponseWriter, req *http.Request) {}).Methods("POST", "GET")
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		body   string
+		length string
+		called string
+	}{
+		{"HEAD", "/health", 200, "", "2", "HEAD"},
+		{"GET", "/health", 200, "ok", "", "GET"},
+		{"HEAD", "/head", 200, "", "42", "explicit HEAD"},
+		{"HEAD", "/empty/1", 204, "", "", "HEAD 1"},
+		{"HEAD", "/stream", 200, "", "", ""},
+		{"HEAD", "/missing", 404, "404 page not found\n", "", ""},
+	}
+	for _, test := range tests {
+		method = ""
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.url, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code == 0 {
+			res.Code = 200
+		}
+		if res.Code != test.code || res.Body.String() != test.body ||
+			res.HeaderMap.Get("Content-Length") != test.length || method != test.called {
+			t.Errorf("%s %s: expected %d %q with length %q calling %q, got %d %q with length %q calling %q",
+				test.method, test.url, test.code, test.body, test.length, test.called,
+				res.Code, res.Body.String(), res.HeaderMap.Get("Content-Length"), method)
+		}
+	}
+
+	req, _ := http.NewRequest("PUT", "http://localhost/post", nil)
+	res := NewRecorder()
+	r.ServeHTTP(res, req)
+	if allow := res.HeaderMap.Get("Allow"); res.Code != 405 || allow != "POST, GET, HEAD" {
+		t.Errorf("Expected 405 with HEAD allowed, got %d with %q", res.Code, allow)
+	}
+
+	// Disabled by default.
+	r.AutoHead(false)
+	req, _ = http.NewRequest("HEAD", "http://localhost/health", nil)
+	res = NewRecorder()
+	r.ServeHTTP(res, req)
+	if allow := res.HeaderMap.Get("Allow"); res.Code != 405 || allow != "GET" {
+		t.Errorf("Expected 405 without HEAD allowed, got %d with %q", res.Code, allow)
+	}
+
+	// The header is still written if hijacking fails.
+	res = NewRecorder()
+	w := &headResponseWriter{ResponseWriter: failingHijacker{res}}
+	if _, _, err := w.Hijack(); err == nil {
+		t.Errorf("Expected error hijacking")
+	}
+	w.finish()
+	if res.Code != 200 || res.HeaderMap.Get("Content-Length") != "0" {
+		t.Errorf("Expected header after failed hijack, got %d", res.Code)
+	}
+}
+
+// failingHijacker is a writer that fails to hijack the connection.
+type failingHijacker struct {
+	*ResponseRecorder
+}
+
+func (w failingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack failed")
+}
@@ -0,0 +1,196 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeIndex narrows down the routes of a router that can match a request,
+// so that Router.Match() doesn't need to test all of them.
+//
+// Routes are indexed in trees by host name and by the static segments of
+// their path templates. Variables taking a whole path segment with the
+// default pattern are indexed as wildcards. Anything else (variables with
+// custom patterns, segments mixing text and variables or routes without a
+// host or path) stops the indexing for a route, which is then a candidate
+// for any request that reached that point.
+//
+// The index only selects candidates: they still go through Route.Match(),
+// in the order they were registered, so the first route that matches wins
+// as before.
+type routeIndex struct {
+	// Trees for routes with a static host, by host.
+	hosts map[string]*indexNode
+	// Tree for routes without a host or with host variables.
+	anyHost *indexNode
+	// True to look up the encoded request path. See Router.UseEncodedPath().
+	encoded bool
+}
+
+// indexNode is a node in a tree of path segments.
+type indexNode struct {
+	// Children for static segments.
+	static map[string]*indexNode
+	// Child for a segment with a variable using the default pattern.
+	wildcard *indexNode
+	// Routes whose path ends at this node.
+	routes []int
+	// Routes that accept any path continuing from this node.
+	prefix []int
+}
+
+// newRouteIndex builds an index for the given routes. If encoded is true,
+// the encoded request path is looked up.
+func newRouteIndex(routes []*Route, encoded bool) *routeIndex {
+	idx := &routeIndex{
+		hosts:   make(map[string]*indexNode),
+		anyHost: new(indexNode),
+		encoded: encoded,
+	}
+	for k, route := range routes {
+		var host, path *routeRegexp
+		for _, m := range route.matchers {
+			if rr, ok := m.(*routeRegexp); ok {
+				switch rr.regexpType {
+				case regexpTypeHost:
+					host = rr
+				case regexpTypePath:
+					path = rr
+				}
+			}
+		}
+		if path != nil && path.useEncodedPath != encoded {
+			// Created before the router setting changed: the path form
+			// differs, so the route is always a candidate.
+			path = nil
+		}
+		node := idx.anyHost
+		if host != nil && len(host.varsN) == 0 {
+			if node = idx.hosts[host.template]; node == nil {
+				node = new(indexNode)
+				idx.hosts[host.template] = node
+			}
+		}
+		node.add(k, path)
+	}
+	return idx
+}
+
+// add indexes the route at position k, using its path matcher.
+func (n *indexNode) add(k int, path *routeRegexp) {
+	if path == nil {
+		n.prefix = append(n.prefix, k)
+		return
+	}
+	tpl := path.template
+	if path.matchPrefix {
+		if strings.HasSuffix(tpl, "/") {
+			tpl = tpl[:len(tpl)-1]
+		} else if i := strings.LastIndex(tpl, "/"); i != -1 {
+			// The last segment is incomplete.
+			tpl = tpl[:i]
+		}
+	}
+	for _, seg := range splitTemplate(tpl, path.matchPrefix) {
+		switch {
+		case !strings.Contains(seg, "{"):
+			if n.static == nil {
+				n.static = make(map[string]*indexNode)
+			}
+			child := n.static[seg]
+			if child == nil {
+				child = new(indexNode)
+				n.static[seg] = child
+			}
+			n = child
+		case seg[0] == '{' && seg[len(seg)-1] == '}' &&
+			strings.Count(seg, "{") == 1 && !strings.Contains(seg, ":"):
+			if n.wildcard == nil {
+				n.wildcard = new(indexNode)
+			}
+			n = n.wildcard
+		default:
+			n.prefix = append(n.prefix, k)
+			return
+		}
+	}
+	if path.matchPrefix {
+		n.prefix = append(n.prefix, k)
+	} else {
+		n.routes = append(n.routes, k)
+	}
+}
+
+// candidates appends to c the positions of the routes that can match the
+// request, in ascending order, and returns it.
+func (idx *routeIndex) candidates(req *http.Request, c []int) []int {
+	path := getPath(req, idx.encoded)
+	if strings.HasSuffix(path, "/") {
+		path = path[:len(path)-1]
+	}
+	host := getHost(req, false)
+	if node := idx.hosts[host]; node != nil {
+		c = node.collect(c, path, false)
+	}
+	if hostPort := getHost(req, true); hostPort != host {
+		// For templates with a port.
+		if node := idx.hosts[hostPort]; node != nil {
+			c = node.collect(c, path, false)
+		}
+	}
+	c = idx.anyHost.collect(c, path, false)
+	sort.Ints(c)
+	return c
+}
+
+// collect appends to c the routes from this node that can match the path.
+// The path is what is left after the segments consumed to reach the node;
+// done is true when all segments were consumed.
+func (n *indexNode) collect(c []int, path string, done bool) []int {
+	c = append(c, n.prefix...)
+	if done {
+		return append(c, n.routes...)
+	}
+	seg, rest := path, ""
+	if i := strings.IndexByte(path, '/'); i != -1 {
+		seg, rest = path[:i], path[i+1:]
+	}
+	last := seg == path
+	if child := n.static[seg]; child != nil {
+		c = child.collect(c, rest, last)
+	}
+	if n.wildcard != nil && seg != "" {
+		c = n.wildcard.collect(c, rest, last)
+	}
+	return c
+}
+
+// splitTemplate splits a path template in segments, ignoring slashes inside
+// variables. Unless it is a prefix, a trailing slash is removed first, like
+// it is done for request paths.
+func splitTemplate(tpl string, prefix bool) []string {
+	if !prefix && strings.HasSuffix(tpl, "/") {
+		tpl = tpl[:len(tpl)-1]
+	}
+	var segments []string
+	var level, start int
+	for i := 0; i < len(tpl); i++ {
+		switch tpl[i] {
+		case '{':
+			level++
+		case '}':
+			level--
+		case '/':
+			if level == 0 {
+				segments = append(segments, tpl[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, tpl[start:])
+}
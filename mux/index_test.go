@@ -0,0 +1,144 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Templates matched segment by segment must behave exactly like their regexps.
+func TestTemplateSegments(t *testing.T) {
+	templates := []struct {
+		tpl                                 string
+		matchHost, matchPrefix, strictSlash bool
+	}{
+		{"/", false, false, false},
+		{"/", false, false, true},
+		{"/", false, true, false},
+		{"/foo", false, false, false},
+		{"/foo/", false, false, false},
+		{"/foo", false, false, true},
+		{"/foo/", false, false, true},
+		{"/foo", false, true, false},
+		{"/foo/", false, true, false},
+		{"/foo/{v1}", false, false, false},
+		{"/foo/{v1}", false, false, true},
+		{"/foo/{v1}/", false, false, true},
+		{"/foo/{v1}", false, true, false},
+		{"/{v1}/bar/{v2}", false, false, false},
+		{"/{v1}/{v2}/", false, true, false},
+		{"/foo//{v1}", false, false, false},
+		{"{v1}.domain.com", true, false, false},
+		{"www.{v1}.com", true, false, false},
+		{"www.domain.com", true, false, false},
+	}
+	inputs := []string{
+		"", "/", "//", "/foo", "/foo/", "/foo//", "/foobar", "/foo/bar",
+		"/foo/bar/", "/foo/bar/baz", "/foo//bar", "/foo/bar/bar/baz",
+		"/bar/bar/baz", "/a/b/", "/a/b/c", "domain.com", "www.domain.com",
+		"a.domain.com", ".domain.com", "www.domain.com.", "www..com",
+	}
+	for _, v := range templates {
+		typ := regexpTypePath
+		if v.matchHost {
+			typ = regexpTypeHost
+		}
+		r, err := newRouteRegexp(v.tpl, typ, v.matchPrefix, v.strictSlash, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", v.tpl, err)
+		}
+		if r.segments == nil {
+			t.Errorf("%q: expected template segments", v.tpl)
+			continue
+		}
+		for _, s := range inputs {
+			expected := r.regexp.FindStringSubmatch(s)
+			got := r.values(s)
+			if (expected == nil) != (got == nil) || (expected != nil && fmt.Sprint(expected[1:]) != fmt.Sprint(got)) {
+				t.Errorf("%+v: expected %q for %q, got %q", v, expected, s, got)
+			}
+			if r.matchString(s) != (expected != nil) {
+				t.Errorf("%+v: expected match %v for %q", v, expected != nil, s)
+			}
+		}
+	}
+
+	// These need the regexp.
+	for _, tpl := range []string{"/{v1:[0-9]+}", "/foo-{v1}", "/{v1}.json", "/{v1}{v2}"} {
+		r, _ := newRouteRegexp(tpl, regexpTypePath, false, false, nil)
+		if r.segments != nil {
+			t.Errorf("%q: expected no template segments", tpl)
+		}
+	}
+}
+
+// The index must give the same results as testing all routes in order.
+func TestRouteIndex(t *testing.T) {
+	r := NewRouter()
+	r.Path("/foo/{v1}")
+	r.Path("/foo/bar")
+	r.Path("/foo/bar/").Methods("POST")
+	r.PathPrefix("/foo/")
+	r.Path("/{v1:[a-z]+}/baz")
+	r.Path("/{v1}/{v2}/ding")
+	r.Host("www.domain.com").Path("/foo/baz")
+	r.Host("{v1}.domain.com").Path("/foo/{v2}/{v3:.*}")
+	r.Path("/ding-{v1}/dong")
+	r.PathPrefix("/ding").Subrouter().Path("/ding/{v1}")
+	r.Host("ding.domain.com")
+	r.Path("/")
+	r.StrictSlash(true)
+	r.Path("/strict/")
+	r.Path("/strict/{v1}")
+	r.MatcherFunc(func(r *http.Request, m *RouteMatch) bool { return true })
+
+	urls := []string{
+		"/", "/foo", "/foo/", "/foo/bar", "/foo/bar/", "/foo/baz", "/foo/ding/dong",
+		"/bar/baz", "/1/baz", "/1/2/ding", "/ding-1/dong", "/ding/ding/1",
+		"/strict", "/strict/", "/strict/1", "/strict/1/", "/nothing",
+	}
+	hosts := []string{"localhost", "www.domain.com", "ding.domain.com"}
+	for _, method := range []string{"GET", "POST"} {
+		for _, host := range hosts {
+			for _, u := range urls {
+				req, _ := http.NewRequest(method, "http://"+host+u, nil)
+				var expected RouteMatch
+				for _, route := range r.getTable().routes {
+					if route.Match(req, &expected) {
+						break
+					}
+				}
+				var got RouteMatch
+				r.Match(req, &got)
+				if got.Route != expected.Route || !stringMapEqual(got.Vars, expected.Vars) {
+					t.Errorf("%s %s%s: expected route %v, got %v", method, host, u, routeString(expected.Route), routeString(got.Route))
+				}
+			}
+		}
+	}
+
+	// Routes and matchers added after matching are indexed too.
+	r = NewRouter()
+	r.Path("/foo")
+	req, _ := http.NewRequest("GET", "http://localhost/bar", nil)
+	var match RouteMatch
+	if r.Match(req, &match) {
+		t.Errorf("Expected no match")
+	}
+	route := r.NewRoute()
+	route.Path("/bar")
+	if !r.Match(req, &match) || match.Route != route {
+		t.Errorf("Expected a match for the added route")
+	}
+}
+
+func routeString(route *Route) string {
+	if route == nil {
+		return "none"
+	}
+	return getRouteTemplate(route)
+}
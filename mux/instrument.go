@@ -0,0 +1,130 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a request served by a router. See Router.Instrument().
+type RequestInfo struct {
+	// The served request.
+	Request *http.Request
+	// The matched route, or nil if no route matched.
+	Route *Route
+	// Status code of the response: 200 if the handler didn't set one, or 0
+	// if it hijacked the connection.
+	Status int
+	// Number of bytes of the response body.
+	Bytes int64
+	// Time taken to match the request and run the handler.
+	Duration time.Duration
+}
+
+// Instrument sets a function called after each request is served, to
+// collect metrics. It gets the matched route, so metrics can be labeled by
+// route name or template instead of by URL:
+//
+//     r.Instrument(func(info mux.RequestInfo) {
+//         if info.Route != nil {
+//             log.Println(info.Route.GetName(), info.Status, info.Duration)
+//         }
+//     })
+//
+// The response writer is wrapped to record the status code and length. The
+// wrapper supports http.Flusher and http.Hijacker when the original writer
+// does, and http.ResponseController through its Unwrap method.
+//
+// This only has effect for the router serving the requests, not for
+// subrouters. The package code.google.com/p/gorilla/mux/muxexpvar provides
+// a function that publishes metrics through expvar.
+func (r *Router) Instrument(f func(RequestInfo)) *Router {
+	r.instrument = f
+	return r
+}
+
+// serveInstrumented dispatches the request recording what is needed to call
+// the instrumentation function.
+func (r *Router) serveInstrumented(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	iw := &instrumentWriter{ResponseWriter: w}
+	route := r.serve(iw, req)
+	status := iw.status
+	if status == 0 && !iw.hijacked {
+		status = http.StatusOK
+	}
+	r.instrument(RequestInfo{
+		Request:  req,
+		Route:    route,
+		Status:   status,
+		Bytes:    iw.bytes,
+		Duration: time.Since(start),
+	})
+}
+
+// errNotHijacker is returned when hijacking a response writer that wraps one
+// that doesn't support it.
+var errNotHijacker = errors.New("mux: the response writer can't be hijacked")
+
+// instrumentWriter records the status code and body length of a response.
+type instrumentWriter struct {
+	http.ResponseWriter
+	// Status code written, or zero.
+	status int
+	// Length of the body written.
+	bytes int64
+	// True if the connection was hijacked.
+	hijacked bool
+}
+
+// WriteHeader records the status code.
+func (w *instrumentWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the body length.
+func (w *instrumentWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the response, if the underlying writer supports it.
+func (w *instrumentWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection, if the underlying writer supports it.
+func (w *instrumentWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *instrumentWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	var info RequestInfo
+	calls := 0
+	r := NewRouter().AutoHead(true).Instrument(func(i RequestInfo) {
+		info = i
+		calls++
+	})
+	r.HandleFunc("/articles/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("article"))
+	}).Methods("GET").Name("article")
+	s := r.PathPrefix("/api").Subrouter()
+	s.HandleFunc("/items", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.(http.Flusher).Flush()
+		w.Write([]byte("{}"))
+	})
+	r.HandleFunc("/empty", func(w http.ResponseWriter, req *http.Request) {})
+
+	tests := []struct {
+		method string
+		url    string
+		route  string
+		status int
+		bytes  int64
+	}{
+		{"GET", "/articles/1", "article", 200, 7},
+		{"HEAD", "/articles/1", "article", 200, 0},
+		{"POST", "/api/items", "/api/items", 201, 2},
+		{"GET", "/empty", "/empty", 200, 0},
+		{"POST", "/articles/1", "", 405, 23},
+		{"GET", "/missing", "", 404, 19},
+		{"GET", "/a/../empty", "", 301, 0},
+	}
+	for _, test := range tests {
+		calls = 0
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.url, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		route := ""
+		if info.Route != nil {
+			route = info.Route.Label()
+		}
+		if calls != 1 || info.Request != req || route != test.route || info.Status != test.status ||
+			info.Bytes != test.bytes || info.Duration <= 0 {
+			t.Errorf("%s %s: expected %q, %d and %d bytes, got %d calls with %q, %d and %d bytes in %v",
+				test.method, test.url, test.route, test.status, test.bytes, calls, route,
+				info.Status, info.Bytes, info.Duration)
+		}
+	}
+	res := NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost/api/items", nil)
+	if r.ServeHTTP(res, req); !res.Flushed {
+		t.Errorf("Expected response to be flushed")
+	}
+
+	// Hijacked connections. The function is called once the handler
+	// returns, after the client got the response.
+	done := make(chan RequestInfo, 1)
+	r.Instrument(func(i RequestInfo) {
+		done <- i
+	})
+	r.HandleFunc("/hijack", func(w http.ResponseWriter, req *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+		conn.Close()
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+	if res, err := http.Get(server.URL + "/hijack"); err != nil || res.StatusCode != 204 {
+		t.Fatalf("Unexpected response: %v, %v", res, err)
+	}
+	if info = <-done; info.Status != 0 || info.Route == nil || info.Route.Label() != "/hijack" {
+		t.Errorf("Expected hijacked request, got status %d", info.Status)
+	}
+	if _, _, err := (&instrumentWriter{ResponseWriter: NewRecorder()}).Hijack(); err != errNotHijacker {
+		t.Errorf("Expected error hijacking a recorder, got %v", err)
+	}
+}
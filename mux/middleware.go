@@ -0,0 +1,46 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+)
+
+// MiddlewareFunc is a function which receives an http.Handler and returns
+// another http.Handler. Typically, the returned handler is a closure which
+// does something with the http.ResponseWriter and http.Request passed to it,
+// and then calls the handler passed as parameter to the MiddlewareFunc.
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// Use appends middlewares to the chain of the router.
+//
+// Middlewares are applied only when a route matches, in the order they were
+// added: the first one wraps all the others. Subrouters apply the
+// middlewares of their parent routers first, then their own. Inside a
+// middleware, mux.Vars() and mux.CurrentRoute() return the values for the
+// matched route. For example:
+//
+//     r := mux.NewRouter()
+//     r.Use(loggingMiddleware)
+//     s := r.PathPrefix("/admin").Subrouter()
+//     s.Use(authMiddleware)
+//
+// Here, requests for routes registered in the subrouter go through
+// loggingMiddleware, then authMiddleware, then the route handler.
+func (r *Router) Use(mwf ...MiddlewareFunc) *Router {
+	r.middlewares = append(r.middlewares, mwf...)
+	return r
+}
+
+// applyMiddlewares wraps the handler of a matched route with the router
+// middlewares.
+func (r *Router) applyMiddlewares(match *RouteMatch) {
+	if match.Handler == nil || match.noMiddlewares {
+		return
+	}
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		match.Handler = r.middlewares[i](match.Handler)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	mw := func(name string) MiddlewareFunc {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				route := CurrentRoute(r)
+				calls = append(calls, fmt.Sprintf("%s:%s:%s", name, route.GetName(), Vars(r)["id"]))
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}
+
+	r := NewRouter()
+	r.Use(mw("a"), mw("b"))
+	r.HandleFunc("/foo/{id}", handler).Methods("GET").Name("foo")
+	s := r.PathPrefix("/sub").Subrouter()
+	s.Use(mw("c"))
+	s.HandleFunc("/bar/{id}", handler).Name("bar")
+
+	tests := []struct {
+		method string
+		url    string
+		calls  string
+	}{
+		{"GET", "http://localhost/foo/1", "[a:foo:1 b:foo:1 handler]"},
+		{"GET", "http://localhost/sub/bar/2", "[a:bar:2 b:bar:2 c:bar:2 handler]"},
+		// Middlewares don't run when no route matches.
+		{"GET", "http://localhost/baz", "[]"},
+		{"POST", "http://localhost/foo/1", "[]"},
+	}
+	for _, test := range tests {
+		calls = []string{}
+		req, _ := http.NewRequest(test.method, test.url, nil)
+		r.ServeHTTP(NewRecorder(), req)
+		if fmt.Sprint(calls) != test.calls {
+			t.Errorf("%s %s: expected calls %v, got %v", test.method, test.url, test.calls, calls)
+		}
+	}
+}
+
+func TestRouteMeta(t *testing.T) {
+	type cacheKey struct{}
+	var scope, cache interface{}
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := NewRouter().Meta("scope", "public")
+	r.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := CurrentRoute(r)
+			scope, cache = route.GetMeta("scope"), route.GetMeta(cacheKey{})
+			h.ServeHTTP(w, r)
+		})
+	})
+	r.HandleFunc("/", handler).Meta(cacheKey{}, "1h")
+	admin := r.PathPrefix("/admin").Meta("scope", "admin").Meta(cacheKey{}, "none").Subrouter()
+	admin.HandleFunc("/users", handler)
+	admin.HandleFunc("/stats", handler).Meta(cacheKey{}, nil)
+	api := r.PathPrefix("/api").Subrouter().Meta("scope", "api")
+	api.HandleFunc("/items", handler)
+	api.HandleFunc("/me", handler).Meta("scope", "user")
+
+	tests := []struct {
+		url   string
+		scope interface{}
+		cache interface{}
+	}{
+		{"/", "public", "1h"},
+		{"/admin/users", "admin", "none"},
+		// Values can be overridden with nil.
+		{"/admin/stats", "admin", nil},
+		{"/api/items", "api", nil},
+		{"/api/me", "user", nil},
+	}
+	for _, test := range tests {
+		scope, cache = "unset", "unset"
+		req, _ := http.NewRequest("GET", "http://localhost"+test.url, nil)
+		r.ServeHTTP(NewRecorder(), req)
+		if scope != test.scope || cache != test.cache {
+			t.Errorf("%s: expected %v and %v, got %v and %v", test.url, test.scope, test.cache, scope, cache)
+		}
+	}
+}
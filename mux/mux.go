@@ -5,16 +5,36 @@
 package mux
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 
-	"code.google.com/p/gorilla/context"
+	gcontext "code.google.com/p/gorilla/context"
+)
+
+var (
+	// ErrMethodMismatch is set in RouteMatch.MatchErr when a route matched
+	// the request except for its HTTP method.
+	ErrMethodMismatch = errors.New("mux: method mismatch")
+	// ErrNotAcceptable is set in RouteMatch.MatchErr when a route matched
+	// the request except for the media types it accepts.
+	// See Route.Accepts().
+	ErrNotAcceptable = errors.New("mux: not acceptable")
+	// ErrUnsupportedMediaType is set in RouteMatch.MatchErr when a route
+	// matched the request except for its content type. See Route.Consumes().
+	ErrUnsupportedMediaType = errors.New("mux: unsupported media type")
 )
 
 // NewRouter returns a new router instance.
 func NewRouter() *Router {
-	return &Router{namedRoutes: make(map[string]*Route)}
+	return &Router{namedRoutes: make(map[string]*Route),
+		namesLock: new(sync.RWMutex)}
 }
 
 // Router registers routes to be matched and dispatches a handler.
@@ -38,43 +58,195 @@ func NewRouter() *Router {
 type Router struct {
 	// Configurable Handler to be used when no route matches.
 	NotFoundHandler http.Handler
+	// Configurable Handler to be used when a route matches everything but
+	// the request method. The Allow header is already set when it is called.
+	MethodNotAllowedHandler http.Handler
+	// Configurable Handler to be used when a route matches everything but
+	// the media types accepted by the client. See Route.Accepts().
+	NotAcceptableHandler http.Handler
+	// Configurable Handler to be used when a route matches everything but
+	// the content type of the request. See Route.Consumes().
+	UnsupportedMediaTypeHandler http.Handler
 	// Parent route, if this is a subrouter.
 	parent parentRoute
-	// Routes to be matched, in order.
-	routes []*Route
-	// Routes by name for URL building.
+	// Routes to be matched, in order, and their index. It holds a
+	// *routeTable, replaced as a whole when the routes change.
+	table atomic.Value
+	// Serializes changes to the route table.
+	tableLock sync.Mutex
+	// Routes by name for URL building, shared with subrouters.
 	namedRoutes map[string]*Route
+	// Guards namedRoutes, shared with subrouters.
+	namesLock *sync.RWMutex
 	// See Router.StrictSlash(). This defines the flag for new routes.
 	strictSlash bool
+	// See Router.TrustProxyHeaders().
+	trustProxyHeaders bool
+	// See Router.UseEncodedPath(). This defines the flag for new routes.
+	useEncodedPath bool
+	// See Router.SkipClean().
+	skipClean bool
+	// See Router.AutoHead().
+	autoHead bool
+	// See Router.Instrument().
+	instrument func(RequestInfo)
+	// See Router.PathPolicy(). This defines the policy for new routes.
+	pathPolicy PathPolicy
+	// See Router.NamePrefix().
+	namePrefix string
+	// See Router.DefaultSchemes(). These are added to new routes.
+	defaultSchemes []string
+	// See Router.DefaultHeaders(). These are added to new routes.
+	defaultHeaders []string
+	// Metadata values for the routes. See Router.Meta().
+	meta map[interface{}]interface{}
+	// Middlewares applied to matched routes. See Router.Use().
+	middlewares []MiddlewareFunc
+	// Named patterns for route variables. See Router.Pattern().
+	patterns map[string]*namedPattern
+	// CORS policy. See Router.CORS().
+	cors *CORSOptions
 }
 
 // Match matches registered routes against the request.
+//
+// Routes are tested in the order they were registered and the first one
+// that matches wins. An index based on the route hosts and paths is used
+// to skip the routes that can't match.
+//
+// The exception are routes that negotiate the media type of the response,
+// using Route.Accepts(): when one of them matches, the next routes of the
+// router that do it as well and have the same host and path templates are
+// tested too, and the one with the best quality value for the Accept header
+// of the request wins.
 func (r *Router) Match(req *http.Request, match *RouteMatch) bool {
-	for _, route := range r.routes {
-		if matched := route.Match(req, match); matched {
-			return true
+	matched := false
+	quality := 0.0
+	var first *Route
+	t := r.getTable()
+	// Most requests have few candidates: avoid allocating for them.
+	var buf [16]int
+	for _, k := range t.getIndex(r.useEncodedPath).candidates(req, buf[:0]) {
+		route := t.routes[k]
+		if !matched {
+			if matched = route.Match(req, match); !matched {
+				continue
+			}
+			if quality = route.quality(req); quality < 0 {
+				// No media type negotiation: the first match wins.
+				break
+			}
+			first = route
+		} else if !first.sameTemplates(route) {
+			continue
+		} else if q := route.quality(req); q > quality {
+			m := RouteMatch{noMiddlewares: match.noMiddlewares}
+			if route.Match(req, &m) {
+				*match, quality = m, q
+			}
 		}
 	}
-	return false
+	if matched {
+		r.applyMiddlewares(match)
+	}
+	return matched
 }
 
 // ServeHTTP dispatches the handler registered in the matched route.
 //
 // When there is a match, the route variables can be retrieved calling
-// mux.Vars(request).
+// mux.Vars(request). They are stored in the context of the request passed
+// to the handler, so they are kept in requests derived from it, as with
+// Request.WithContext().
+//
+// When no route matches but some route would match with a different HTTP
+// method, the response is "405 Method Not Allowed" and the Allow header
+// lists the methods accepted by those routes. If those routes have a CORS
+// policy and the request method is OPTIONS, the request is answered
+// according to the policy instead. See Router.CORS().
+//
+// Likewise, the response is "406 Not Acceptable" or "415 Unsupported Media
+// Type" when some route would match if it accepted the media types of the
+// request. See Route.Accepts() and Route.Consumes().
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// Clean path to canonical form and redirect.
-	if p := cleanPath(req.URL.Path); p != req.URL.Path {
-		w.Header().Set("Location", p)
-		w.WriteHeader(http.StatusMovedPermanently)
+	if r.instrument != nil {
+		r.serveInstrumented(w, req)
 		return
 	}
-	var match RouteMatch
+	r.serve(w, req)
+}
+
+// serve dispatches the request and returns the matched route, if any.
+func (r *Router) serve(w http.ResponseWriter, req *http.Request) *Route {
+	orig := req
+	defer gcontext.Clear(req)
+	if !r.skipClean && r.pathPolicy != PathNotFound {
+		// Clean path to canonical form and redirect. With PathNotFound
+		// the path is matched as is.
+		path := getPath(req, r.useEncodedPath)
+		if p := cleanPath(path); p != path {
+			switch r.pathPolicy {
+			case PathServe:
+				req = requestWithPath(req, p, r.useEncodedPath)
+			default:
+				if req.URL.RawQuery != "" {
+					p += "?" + req.URL.RawQuery
+				}
+				w.Header().Set("Location", p)
+				w.WriteHeader(r.pathPolicy.redirectCode(req.Method))
+				return nil
+			}
+		}
+	}
+	rc := &routeContext{Context: req.Context(), req: orig}
+	match := &rc.match
 	var handler http.Handler
-	if matched := r.Match(req, &match); matched {
+	var head *headResponseWriter
+	matched := r.Match(req, match)
+	if r.autoHead {
+		if !matched && req.Method == "HEAD" {
+			matched = r.matchHead(req, match)
+			if matched {
+				head = &headResponseWriter{ResponseWriter: w}
+				w = head
+			}
+		}
+		if matchInArray(match.allowed, "GET") {
+			match.addAllowed([]string{"HEAD"})
+		}
+	}
+	if matched && req.Method == "OPTIONS" && isPreflight(req) &&
+		match.Route.anyMethod() {
+		// The route matches any method: answer the preflight for the
+		// requested one.
+		if cors := match.Route.getCORS(); cors != nil {
+			cors.preflight(w, req, nil)
+			return nil
+		}
+	}
+	if matched {
 		handler = match.Handler
-		setVars(req, match.Vars)
-		setCurrentRoute(req, match.Route)
+		req = req.WithContext(rc)
+		if cors := match.Route.getCORS(); cors != nil {
+			cors.setHeaders(w, req)
+		}
+	} else if match.MatchErr == ErrMethodMismatch {
+		if match.cors != nil && req.Method == "OPTIONS" {
+			match.cors.preflight(w, req, match.allowed)
+			return nil
+		}
+		w.Header().Set("Allow", strings.Join(match.allowed, ", "))
+		if handler = r.MethodNotAllowedHandler; handler == nil {
+			handler = http.HandlerFunc(methodNotAllowed)
+		}
+	} else if match.MatchErr == ErrNotAcceptable {
+		if handler = r.NotAcceptableHandler; handler == nil {
+			handler = http.HandlerFunc(notAcceptable)
+		}
+	} else if match.MatchErr == ErrUnsupportedMediaType {
+		if handler = r.UnsupportedMediaTypeHandler; handler == nil {
+			handler = http.HandlerFunc(unsupportedMediaType)
+		}
 	}
 	if handler == nil {
 		if r.NotFoundHandler == nil {
@@ -82,25 +254,90 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 		handler = r.NotFoundHandler
 	}
-	defer context.Clear(req)
 	handler.ServeHTTP(w, req)
+	if head != nil {
+		head.finish()
+	}
+	if !matched {
+		return nil
+	}
+	return match.Route
+}
+
+// matchHead matches a HEAD request as if it was a GET request. The match is
+// only changed if it matches. See Router.AutoHead().
+func (r *Router) matchHead(req *http.Request, match *RouteMatch) bool {
+	get := req.WithContext(req.Context())
+	get.Method = "GET"
+	var m RouteMatch
+	if !r.Match(get, &m) {
+		return false
+	}
+	*match = m
+	return true
 }
 
-// Get returns a route registered with the given name.
+// Get returns a route registered with the given name. The name is prefixed
+// by the name prefix of the router. See Router.NamePrefix().
 func (r *Router) Get(name string) *Route {
-	return r.getNamedRoutes()[name]
+	names, lock := r.getNamedRoutes()
+	lock.RLock()
+	defer lock.RUnlock()
+	return names[r.getNamePrefix()+name]
 }
 
 // GetRoute returns a route registered with the given name. This method
 // was renamed to Get() and remains here for backwards compatibility.
 func (r *Router) GetRoute(name string) *Route {
-	return r.getNamedRoutes()[name]
+	return r.Get(name)
+}
+
+// NamePrefix sets a prefix for the names of the routes registered in the
+// router and its subrouters, after the prefix of the parent router, if any.
+// This avoids name clashes between groups of routes. For example:
+//
+//     r := mux.NewRouter()
+//     admin := r.PathPrefix("/admin").Subrouter().NamePrefix("admin.")
+//     admin.HandleFunc("/users", UsersHandler).Name("users")
+//
+// Here, the route is registered with the name "admin.users". It is returned
+// by r.Get("admin.users") and admin.Get("users"), which prefixes the name.
+//
+// The prefix is only used for routes named after it is set.
+func (r *Router) NamePrefix(prefix string) *Router {
+	r.namePrefix = prefix
+	return r
+}
+
+// DefaultSchemes sets URL schemes for the new routes of the router, as if
+// Route.Schemes() was called for each of them.
+func (r *Router) DefaultSchemes(schemes ...string) *Router {
+	r.defaultSchemes = schemes
+	return r
+}
+
+// DefaultHeaders sets header values for the new routes of the router, as if
+// Route.Headers() was called for each of them.
+func (r *Router) DefaultHeaders(pairs ...string) *Router {
+	r.defaultHeaders = pairs
+	return r
+}
+
+// Meta sets a metadata value for the routes of the router and its
+// subrouters, unless they set their own. See Route.Meta().
+func (r *Router) Meta(key, value interface{}) *Router {
+	if r.meta == nil {
+		r.meta = make(map[interface{}]interface{})
+	}
+	r.meta[key] = value
+	return r
 }
 
 // StrictSlash defines the slash behavior for new routes.
 //
 // When true, if the route path is "/path/", accessing "/path" will redirect
-// to the former and vice versa.
+// to the former and vice versa. See Router.PathPolicy() to serve both paths
+// or change the redirect status code instead.
 //
 // Special case: when a route sets a path prefix, strict slash is
 // automatically set to false for that route because the redirect behavior
@@ -110,20 +347,208 @@ func (r *Router) StrictSlash(value bool) *Router {
 	return r
 }
 
+// UseEncodedPath defines if new routes match the encoded request path.
+//
+// When true, routes match the path as sent by the client instead of the
+// decoded one. Escaped characters like "%2F" can then be part of a variable
+// value:
+//
+//     r := mux.NewRouter().UseEncodedPath(true)
+//     r.HandleFunc("/objects/{key}", ObjectHandler)
+//
+// Here, the path "/objects/a%2Fb" matches and the "key" variable is "a/b":
+// variables are decoded after they are extracted. Likewise, values are
+// escaped when building URLs.
+//
+// Templates must use the encoded form for static text that has characters
+// to be escaped. Call it before registering routes.
+func (r *Router) UseEncodedPath(value bool) *Router {
+	r.useEncodedPath = value
+	return r
+}
+
+// SkipClean defines if the router skips cleaning the request path.
+//
+// By default, paths with "." or ".." segments or repeated slashes are
+// redirected to their cleaned version, e.g. "//path" to "/path". When true,
+// paths are matched as they are. This only has effect for the router serving
+// the requests, not for subrouters.
+func (r *Router) SkipClean(value bool) *Router {
+	r.skipClean = value
+	return r
+}
+
+// AutoHead defines if HEAD requests are served by GET routes when no route
+// matches them, as for load balancer health checks. The handler gets the
+// HEAD request, and the body it writes is discarded; the headers are kept,
+// and Content-Length is set to the length of the discarded body unless the
+// handler set it or flushed the response. The "405 Method Not Allowed"
+// responses list HEAD in the Allow header when they list GET.
+//
+// This only has effect for the router serving the requests, not for
+// subrouters.
+func (r *Router) AutoHead(value bool) *Router {
+	r.autoHead = value
+	return r
+}
+
+// PathPolicy defines how requests are handled when their path isn't the
+// canonical one. See Router.PathPolicy().
+type PathPolicy int
+
+const (
+	// PathRedirectPermanent redirects to the canonical path, with status
+	// "301 Moved Permanently" for GET and HEAD requests and "308 Permanent
+	// Redirect" for other methods, so that clients keep the method and
+	// body. This is the default.
+	PathRedirectPermanent PathPolicy = iota
+	// PathRedirectTemporary redirects to the canonical path, with status
+	// "302 Found" for GET and HEAD requests and "307 Temporary Redirect"
+	// for other methods.
+	PathRedirectTemporary
+	// PathServe serves the request as if it had the canonical path,
+	// without redirecting.
+	PathServe
+	// PathNotFound doesn't match the request, so it gets a 404 unless
+	// another route matches. Paths that aren't clean are matched as they
+	// are.
+	PathNotFound
+)
+
+// redirectCode returns the status code to redirect a request with the given
+// method.
+func (p PathPolicy) redirectCode(method string) int {
+	get := method == "GET" || method == "HEAD"
+	switch {
+	case p == PathRedirectTemporary && get:
+		return http.StatusFound
+	case p == PathRedirectTemporary:
+		return http.StatusTemporaryRedirect
+	case get:
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
+// PathPolicy defines how requests are handled when their path differs from
+// the route path only by the trailing slash, for routes with strict slash,
+// or when their path isn't clean. See PathPolicy.
+//
+// The policy for the trailing slash is set for new routes, so subrouters
+// can have their own. The policy for unclean paths is the one of the router
+// serving the requests, not of its subrouters.
+func (r *Router) PathPolicy(policy PathPolicy) *Router {
+	r.pathPolicy = policy
+	return r
+}
+
+// TrustProxyHeaders defines if the X-Forwarded-Proto and X-Forwarded-Host
+// headers are used to build absolute URLs. See Route.AbsoluteURL().
+//
+// These headers are set by clients as well, so only enable this when the
+// router runs behind a reverse proxy that sets them. Subrouters trust the
+// headers when their parent router does.
+func (r *Router) TrustProxyHeaders(value bool) *Router {
+	r.trustProxyHeaders = value
+	return r
+}
+
+// Walk walks the router and all its subrouters, calling walkFn for each
+// route in the order they were registered. walkFn receives the route, the
+// router where it was registered and the routes leading to that router,
+// starting from the outermost one.
+//
+// If walkFn returns SkipRouter for a route, the subrouters of that route are
+// not walked. Any other error stops the walk and is returned by Walk.
+func (r *Router) Walk(walkFn WalkFunc) error {
+	return r.walk(walkFn, []*Route{})
+}
+
+// SkipRouter is used as a return value from WalkFunc to indicate that the
+// subrouters of a route should not be walked.
+var SkipRouter = errors.New("mux: skip this router")
+
+// WalkFunc is the type of the function called for each route visited by Walk.
+type WalkFunc func(route *Route, router *Router, ancestors []*Route) error
+
+func (r *Router) walk(walkFn WalkFunc, ancestors []*Route) error {
+	for _, route := range r.getTable().routes {
+		err := walkFn(route, r, ancestors)
+		if err == SkipRouter {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, m := range route.matchers {
+			if sub, ok := m.(*Router); ok {
+				// Always copy, so that walkFn can keep the slice it got.
+				a := append(ancestors[:len(ancestors):len(ancestors)], route)
+				if err = sub.walk(walkFn, a); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // ----------------------------------------------------------------------------
 // parentRoute
 // ----------------------------------------------------------------------------
 
-// getNamedRoutes returns the map where named routes are registered.
-func (r *Router) getNamedRoutes() map[string]*Route {
+// getNamedRoutes returns the map where named routes are registered and the
+// lock guarding it.
+func (r *Router) getNamedRoutes() (map[string]*Route, *sync.RWMutex) {
 	if r.namedRoutes == nil {
 		if r.parent != nil {
-			r.namedRoutes = r.parent.getNamedRoutes()
+			r.namedRoutes, r.namesLock = r.parent.getNamedRoutes()
 		} else {
 			r.namedRoutes = make(map[string]*Route)
 		}
 	}
-	return r.namedRoutes
+	if r.namesLock == nil {
+		r.namesLock = new(sync.RWMutex)
+	}
+	return r.namedRoutes, r.namesLock
+}
+
+// getScheme returns the first scheme defined for the parent route, if any.
+func (r *Router) getScheme() string {
+	if r.parent != nil {
+		return r.parent.getScheme()
+	}
+	return ""
+}
+
+// getNamePrefix returns the name prefix for the routes of the router,
+// including the one of its parent router.
+func (r *Router) getNamePrefix() string {
+	if r.parent != nil {
+		return r.parent.getNamePrefix() + r.namePrefix
+	}
+	return r.namePrefix
+}
+
+// getMeta returns the metadata value for the given key set for the router or
+// its parents. The boolean is false if there's no such value.
+func (r *Router) getMeta(key interface{}) (interface{}, bool) {
+	if value, ok := r.meta[key]; ok {
+		return value, true
+	}
+	if r.parent == nil {
+		return nil, false
+	}
+	return r.parent.getMeta(key)
+}
+
+// getTrustProxyHeaders returns true if the router or one of its parents
+// trusts the headers set by reverse proxies.
+func (r *Router) getTrustProxyHeaders() bool {
+	if r.trustProxyHeaders {
+		return true
+	}
+	return r.parent != nil && r.parent.getTrustProxyHeaders()
 }
 
 // getRegexpGroup returns regexp definitions from the parent route, if any.
@@ -140,8 +565,21 @@ func (r *Router) getRegexpGroup() *routeRegexpGroup {
 
 // NewRoute registers an empty route.
 func (r *Router) NewRoute() *Route {
-	route := &Route{parent: r, strictSlash: r.strictSlash}
-	r.routes = append(r.routes, route)
+	route := r.newRoute()
+	r.appendRoute(route)
+	return route
+}
+
+// newRoute returns an empty route for the router, without registering it.
+func (r *Router) newRoute() *Route {
+	route := &Route{parent: r, strictSlash: r.strictSlash,
+		useEncodedPath: r.useEncodedPath, pathPolicy: r.pathPolicy}
+	if r.defaultSchemes != nil {
+		route.Schemes(append([]string(nil), r.defaultSchemes...)...)
+	}
+	if r.defaultHeaders != nil {
+		route.Headers(r.defaultHeaders...)
+	}
 	return route
 }
 
@@ -158,6 +596,18 @@ func (r *Router) HandleFunc(path string, f func(http.ResponseWriter,
 	return r.NewRoute().Path(path).HandlerFunc(f)
 }
 
+// Accepts registers a new route with a matcher for the media types accepted
+// by the client. See Route.Accepts().
+func (r *Router) Accepts(mediaTypes ...string) *Route {
+	return r.NewRoute().Accepts(mediaTypes...)
+}
+
+// Consumes registers a new route with a matcher for the request content
+// type. See Route.Consumes().
+func (r *Router) Consumes(mediaTypes ...string) *Route {
+	return r.NewRoute().Consumes(mediaTypes...)
+}
+
 // Headers registers a new route with a matcher for request header values.
 // See Route.Headers().
 func (r *Router) Headers(pairs ...string) *Route {
@@ -211,47 +661,160 @@ func (r *Router) Schemes(schemes ...string) *Route {
 // ----------------------------------------------------------------------------
 
 // RouteMatch stores information about a matched route.
+//
+// When no route matches, MatchErr tells why, if known: it is set to
+// ErrMethodMismatch when some route rejected the request only because of
+// its HTTP method, and to ErrNotAcceptable or ErrUnsupportedMediaType when
+// some route accepting the method rejected it only because of its media
+// types. The latter take precedence.
 type RouteMatch struct {
-	Route   *Route
-	Handler http.Handler
-	Vars    map[string]string
+	Route    *Route
+	Handler  http.Handler
+	Vars     map[string]string
+	MatchErr error
+	// Methods accepted by the routes that failed with ErrMethodMismatch.
+	allowed []string
+	// Converted variable values. See Router.Pattern().
+	values map[string]interface{}
+	// CORS policy for the routes that failed with ErrMethodMismatch.
+	cors *CORSOptions
+	// Variable values extracted by the route regexps while matching, so
+	// that they are extracted only once. See routeRegexp.Match().
+	captures    [maxCaptures]capture
+	numCaptures int
+	// Storage for the captured values, to avoid allocating it.
+	valueBuf  [maxCapturedValues]string
+	numValues int
+	// Query values of the request, parsed once. See RouteMatch.getQuery().
+	query    url.Values
+	rawQuery string
+	// Set to match without wrapping the handler with the middlewares, when
+	// the handler is not used. See Router.Explain().
+	noMiddlewares bool
+}
+
+// setMatchErr sets MatchErr unless it has an error with higher precedence.
+func (m *RouteMatch) setMatchErr(err error) {
+	rank := func(err error) int {
+		switch err {
+		case ErrMethodMismatch:
+			return 1
+		case ErrNotAcceptable:
+			return 2
+		case ErrUnsupportedMediaType:
+			return 3
+		}
+		return 0
+	}
+	if rank(err) > rank(m.MatchErr) {
+		m.MatchErr = err
+	}
+}
+
+// addAllowed records methods accepted by a route that matched everything
+// but the request method.
+func (m *RouteMatch) addAllowed(methods []string) {
+	for _, v := range methods {
+		if !matchInArray(m.allowed, v) {
+			m.allowed = append(m.allowed, v)
+		}
+	}
 }
 
 type contextKey int
 
-const (
-	varsKey contextKey = iota
-	routeKey
-)
+const matchKey contextKey = 0
+
+// routeContext is the context of the request passed to the handler when a
+// route matches. It holds the match itself, so that storing it in the
+// context doesn't take more allocations.
+type routeContext struct {
+	context.Context
+	// The match for the request.
+	match RouteMatch
+	// The request served by the router, whose gorilla/context values are
+	// shared by the request passed to the handler.
+	req *http.Request
+}
+
+// Value returns the route context for the key used by the router, or the
+// value from the parent context. For gorilla/context.RequestKey, it returns
+// the request served by the router unless the parent context has one.
+func (c *routeContext) Value(key interface{}) interface{} {
+	switch key {
+	case matchKey:
+		return c
+	case gcontext.RequestKey:
+		if v := c.Context.Value(key); v != nil || c.req == nil {
+			return v
+		}
+		return c.req
+	}
+	return c.Context.Value(key)
+}
+
+// getMatch returns the match stored in the request context by the router,
+// or nil.
+func getMatch(r *http.Request) *RouteMatch {
+	if rc, _ := r.Context().Value(matchKey).(*routeContext); rc != nil {
+		return &rc.match
+	}
+	return nil
+}
 
 // Vars returns the route variables for the current request, if any.
 func Vars(r *http.Request) map[string]string {
-	if rv := context.Get(r, varsKey); rv != nil {
-		return rv.(map[string]string)
+	if m := getMatch(r); m != nil {
+		return m.Vars
 	}
 	return nil
 }
 
 // CurrentRoute returns the matched route for the current request, if any.
 func CurrentRoute(r *http.Request) *Route {
-	if rv := context.Get(r, routeKey); rv != nil {
-		return rv.(*Route)
+	if m := getMatch(r); m != nil {
+		return m.Route
 	}
 	return nil
 }
 
-func setVars(r *http.Request, val interface{}) {
-	context.Set(r, varsKey, val)
-}
-
-func setCurrentRoute(r *http.Request, val interface{}) {
-	context.Set(r, routeKey, val)
+// SetURLVars returns a shallow copy of the request with the given route
+// variables, as returned by Vars(). The matched route, if any, is kept.
+// It is meant to test handlers without a router:
+//
+//     req := httptest.NewRequest("GET", "/articles/42", nil)
+//     req = mux.SetURLVars(req, map[string]string{"id": "42"})
+//     ArticleHandler(w, req)
+func SetURLVars(r *http.Request, vars map[string]string) *http.Request {
+	rc := &routeContext{Context: r.Context()}
+	if m := getMatch(r); m != nil {
+		rc.match.Route = m.Route
+		rc.match.values = m.values
+	}
+	rc.match.Vars = vars
+	return r.WithContext(rc)
 }
 
 // ----------------------------------------------------------------------------
 // Helpers
 // ----------------------------------------------------------------------------
 
+// requestWithPath returns a shallow copy of the request with the given path,
+// encoded if the router matches encoded paths.
+func requestWithPath(req *http.Request, p string, encoded bool) *http.Request {
+	u := *req.URL
+	u.Path, u.RawPath = p, ""
+	if encoded {
+		if path, err := url.PathUnescape(p); err == nil {
+			u.Path = path
+			u.RawPath = p
+		}
+	}
+	req = req.WithContext(req.Context())
+	req.URL = &u
+	return req
+}
+
 // cleanPath returns the canonical path for p, eliminating . and .. elements.
 // Borrowed from the net/http package.
 func cleanPath(p string) string {
@@ -270,6 +833,22 @@ func cleanPath(p string) string {
 	return np
 }
 
+// methodNotAllowed replies to the request with an HTTP 405 error.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// notAcceptable replies to the request with an HTTP 406 error.
+func notAcceptable(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "406 not acceptable", http.StatusNotAcceptable)
+}
+
+// unsupportedMediaType replies to the request with an HTTP 415 error.
+func unsupportedMediaType(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "415 unsupported media type",
+		http.StatusUnsupportedMediaType)
+}
+
 // uniqueVars returns an error if two slices contain duplicated strings.
 func uniqueVars(s1, s2 []string) error {
 	for _, v1 := range s1 {
@@ -5,9 +5,15 @@
 package mux
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+
+	gcontext "code.google.com/p/gorilla/context"
 )
 
 func TestRoute(t *testing.T) {
@@ -309,6 +315,729 @@ func TestNamedRoutes(t *testing.T) {
 	}
 }
 
+func TestMethodNotAllowed(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := NewRouter()
+	r.HandleFunc("/foo", handler).Methods("GET", "HEAD")
+	s := r.PathPrefix("/foo").Subrouter()
+	s.HandleFunc("/", handler).Methods("POST")
+	r.HandleFunc("/foo", handler).Methods("PUT", "GET")
+
+	// The path matches but the method doesn't.
+	req, _ := http.NewRequest("DELETE", "http://localhost/foo", nil)
+	rsp := NewRecorder()
+	r.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %v, got %v", http.StatusMethodNotAllowed, rsp.Code)
+	}
+	if allow := rsp.HeaderMap.Get("Allow"); allow != "GET, HEAD, PUT" {
+		t.Errorf("Expected Allow header %q, got %q", "GET, HEAD, PUT", allow)
+	}
+	var match RouteMatch
+	if r.Match(req, &match) || match.MatchErr != ErrMethodMismatch {
+		t.Errorf("Expected ErrMethodMismatch, got %v", match.MatchErr)
+	}
+
+	// Methods from subrouters are collected as well.
+	req, _ = http.NewRequest("DELETE", "http://localhost/foo/", nil)
+	rsp = NewRecorder()
+	r.ServeHTTP(rsp, req)
+	if allow := rsp.HeaderMap.Get("Allow"); allow != "POST" {
+		t.Errorf("Expected Allow header %q, got %q", "POST", allow)
+	}
+
+	// A match clears the error.
+	req, _ = http.NewRequest("PUT", "http://localhost/foo", nil)
+	match = RouteMatch{}
+	if !r.Match(req, &match) || match.MatchErr != nil {
+		t.Errorf("Expected a match, got error %v", match.MatchErr)
+	}
+
+	// Nothing matches the path.
+	req, _ = http.NewRequest("DELETE", "http://localhost/bar", nil)
+	rsp = NewRecorder()
+	r.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v, got %v", http.StatusNotFound, rsp.Code)
+	}
+
+	// Custom handler.
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	req, _ = http.NewRequest("DELETE", "http://localhost/foo", nil)
+	rsp = NewRecorder()
+	r.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusTeapot {
+		t.Errorf("Expected status %v, got %v", http.StatusTeapot, rsp.Code)
+	}
+	if allow := rsp.HeaderMap.Get("Allow"); allow != "GET, HEAD, PUT" {
+		t.Errorf("Expected Allow header %q, got %q", "GET, HEAD, PUT", allow)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	r := NewRouter()
+	r.Path("/a").Name("a")
+	s1 := r.PathPrefix("/b").Name("b").Subrouter()
+	s1.Path("/c").Name("c")
+	s2 := s1.PathPrefix("/d").Name("d").Subrouter()
+	s2.Path("/e").Name("e")
+	r.PathPrefix("/f").Name("f").Subrouter().Path("/g").Name("g")
+
+	var got []string
+	err := r.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		name := route.GetName()
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			name = ancestors[i].GetName() + "/" + name
+		}
+		got = append(got, name)
+		if route.GetName() == "f" {
+			return SkipRouter
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "[a b b/c b/d b/d/e f]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	stop := fmt.Errorf("stop")
+	err = r.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		if route.GetName() == "c" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Expected error %v, got %v", stop, err)
+	}
+}
+
+func TestRouteIntrospection(t *testing.T) {
+	r := NewRouter()
+	s := r.Host("{sub}.domain.com").Subrouter()
+	route := s.Path("/articles/{id:[0-9]+}").
+		Methods("get", "post").
+		Schemes("https").
+		Queries("foo", "bar").
+		Headers("X-Requested-With", "XMLHttpRequest")
+
+	if tpl, err := route.GetPathTemplate(); err != nil || tpl != "/articles/{id:[0-9]+}" {
+		t.Errorf("Unexpected path template %q, error %v", tpl, err)
+	}
+	if tpl, err := route.GetHostTemplate(); err != nil || tpl != "{sub}.domain.com" {
+		t.Errorf("Unexpected host template %q, error %v", tpl, err)
+	}
+	if methods, err := route.GetMethods(); err != nil || fmt.Sprint(methods) != "[GET POST]" {
+		t.Errorf("Unexpected methods %v, error %v", methods, err)
+	}
+	if schemes, err := route.GetSchemes(); err != nil || fmt.Sprint(schemes) != "[https]" {
+		t.Errorf("Unexpected schemes %v, error %v", schemes, err)
+	}
+	if queries, err := route.GetQueries(); err != nil || !stringMapEqual(queries, map[string]string{"foo": "bar"}) {
+		t.Errorf("Unexpected queries %v, error %v", queries, err)
+	}
+	if headers, err := route.GetHeaders(); err != nil || !stringMapEqual(headers, map[string]string{"X-Requested-With": "XMLHttpRequest"}) {
+		t.Errorf("Unexpected headers %v, error %v", headers, err)
+	}
+	route = s.Path("/items/{item:int}").Queries("q", "{q}")
+	if patterns, err := route.GetVarPatterns(); err != nil || !stringMapEqual(patterns, map[string]string{"sub": "[^.]+", "item": "[0-9]+", "q": ".*"}) {
+		t.Errorf("Unexpected variable patterns %v, error %v", patterns, err)
+	}
+
+	// Attributes not defined.
+	route = r.NewRoute()
+	if _, err := route.GetPathTemplate(); err == nil {
+		t.Errorf("Expected error for missing path")
+	}
+	if _, err := route.GetHostTemplate(); err == nil {
+		t.Errorf("Expected error for missing host")
+	}
+	if _, err := route.GetMethods(); err == nil {
+		t.Errorf("Expected error for missing methods")
+	}
+	if _, err := route.GetSchemes(); err == nil {
+		t.Errorf("Expected error for missing schemes")
+	}
+	if _, err := route.GetQueries(); err == nil {
+		t.Errorf("Expected error for missing queries")
+	}
+	if _, err := route.GetHeaders(); err == nil {
+		t.Errorf("Expected error for missing headers")
+	}
+	if _, err := route.GetVarPatterns(); err == nil {
+		t.Errorf("Expected error for missing variables")
+	}
+
+	// Route with an error.
+	route = r.Path("no-slash")
+	if _, err := route.GetMethods(); err == nil || err != route.GetError() {
+		t.Errorf("Expected route error, got %v", err)
+	}
+}
+
+func TestQueryVariables(t *testing.T) {
+	r := NewRouter()
+	r.Path("/articles").Queries("page", "{page:[0-9]+}", "q", "{q}", "sort", "").Name("articles")
+	s := r.Queries("lang", "{lang:[a-z]{2}}").Subrouter()
+	s.Path("/news").Queries("page", "{page}").Name("news")
+
+	tests := []struct {
+		url   string
+		route string
+		vars  map[string]string
+		built string
+	}{
+		{"/articles?page=2&q=go+lang&sort=", "articles", map[string]string{"page": "2", "q": "go lang"}, "/articles?page=2&q=go+lang&sort="},
+		{"/articles?q=&sort=date&page=10", "articles", map[string]string{"page": "10", "q": ""}, "/articles?page=10&q=&sort="},
+		// The first value that matches is used.
+		{"/articles?page=x&page=3&q=a&sort=", "articles", map[string]string{"page": "3", "q": "a"}, "/articles?page=3&q=a&sort="},
+		{"/articles?page=x&q=a&sort=", "", nil, ""},
+		{"/articles?page=1&q=a", "", nil, ""},
+		{"/news?lang=pt&page=1", "news", map[string]string{"lang": "pt", "page": "1"}, "/news?lang=pt&page=1"},
+		{"/news?lang=portuguese&page=1", "", nil, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "http://localhost"+test.url, nil)
+		var match RouteMatch
+		if !r.Match(req, &match) {
+			if test.route != "" {
+				t.Errorf("%s: expected a match", test.url)
+			}
+			continue
+		}
+		if test.route == "" {
+			t.Errorf("%s: expected no match, got %v", test.url, match.Route.GetName())
+			continue
+		}
+		if match.Route.GetName() != test.route || !stringMapEqual(match.Vars, test.vars) {
+			t.Errorf("%s: expected route %v with vars %v, got %v with %v", test.url, test.route, test.vars, match.Route.GetName(), match.Vars)
+		}
+		u, err := match.Route.URL(mapToPairs(match.Vars)...)
+		if err != nil || u.String() != test.built {
+			t.Errorf("%s: expected URL %v, got %v (error %v)", test.url, test.built, u, err)
+		}
+	}
+
+	if _, err := r.Get("articles").URL("page", "x", "q", "y"); err == nil {
+		t.Errorf("Expected error for invalid query value")
+	}
+	if route := new(Route).Path("/{id}").Queries("id", "{id}"); route.GetError() == nil {
+		t.Errorf("Expected error for duplicated variable names")
+	}
+	if route := new(Route).Queries("id"); route.GetError() == nil {
+		t.Errorf("Expected error for odd number of parameters")
+	}
+}
+
+func TestURLBuilding(t *testing.T) {
+	r := NewRouter()
+	r.Host("www.domain.com").Path("/secure/{id}").Schemes("https").Name("secure")
+	r.Path("/articles/{category}").Queries("page", "{page}").Name("articles")
+	s := r.Host("{sub}.domain.com").Schemes("HTTPS", "http").Subrouter()
+	s.Path("/sub").Name("sub")
+	a := r.PathPrefix("/api").Subrouter().TrustProxyHeaders(true)
+	a.Path("/users/{id}").Name("user")
+
+	build := func(name string, f func(*Route) (*url.URL, error)) string {
+		u, err := f(r.Get(name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			return ""
+		}
+		return u.String()
+	}
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	req.Host = "app.domain.com:8080"
+	req.Header.Set("X-Forwarded-Proto", "HTTPS")
+	req.Header.Set("X-Forwarded-Host", "public.domain.com, proxy.local")
+
+	tests := []struct {
+		name     string
+		f        func(*Route) (*url.URL, error)
+		expected string
+	}{
+		{"secure", func(r *Route) (*url.URL, error) { return r.URL("id", "1") }, "https://www.domain.com/secure/1"},
+		{"secure", func(r *Route) (*url.URL, error) { return r.URLHost() }, "https://www.domain.com"},
+		{"sub", func(r *Route) (*url.URL, error) { return r.URL("sub", "news") }, "https://news.domain.com/sub"},
+		{"articles", func(r *Route) (*url.URL, error) {
+			return r.URLQuery(url.Values{"sort": {"date"}, "q": {"a b"}}, "category", "go", "page", "2")
+		}, "/articles/go?page=2&q=a+b&sort=date"},
+		{"articles", func(r *Route) (*url.URL, error) {
+			u, err := r.URLQuery(nil, "category", "go", "page", "2")
+			if u != nil {
+				u.Fragment = "top"
+			}
+			return u, err
+		}, "/articles/go?page=2#top"},
+		// Without trusting proxy headers.
+		{"articles", func(r *Route) (*url.URL, error) {
+			return r.AbsoluteURL(req, "category", "go", "page", "2")
+		}, "http://app.domain.com:8080/articles/go?page=2"},
+		// The route scheme and host win.
+		{"secure", func(r *Route) (*url.URL, error) { return r.AbsoluteURL(req, "id", "1") }, "https://www.domain.com/secure/1"},
+		// Trusting proxy headers.
+		{"user", func(r *Route) (*url.URL, error) { return r.AbsoluteURL(req, "id", "42") }, "https://public.domain.com/api/users/42"},
+	}
+	for _, test := range tests {
+		if got := build(test.name, test.f); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, got)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "https://localhost/", nil)
+	req.TLS = &tls.ConnectionState{}
+	if got := build("articles", func(r *Route) (*url.URL, error) {
+		return r.AbsoluteURL(req, "category", "go", "page", "2")
+	}); got != "https://localhost/articles/go?page=2" {
+		t.Errorf("Expected https URL for TLS request, got %q", got)
+	}
+}
+
+func TestEncodedPath(t *testing.T) {
+	var key string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		key = Vars(req)["key"]
+	}
+	r := NewRouter()
+	r.HandleFunc("/old/{key}", handler)
+	r.UseEncodedPath(true).StrictSlash(true)
+	r.HandleFunc("/objects/{key}", handler).Name("object")
+	r.HandleFunc("/dirs/{key}/", handler)
+	r.HandleFunc("/a%20b/{key:[a-zA-Z%0-9]+}", handler).Name("space")
+
+	tests := []struct {
+		url      string
+		code     int
+		key      string
+		location string
+	}{
+		{"/objects/a%2Fb", 200, "a/b", ""},
+		{"/objects/a%2Fb%3Fc", 200, "a/b?c", ""},
+		{"/objects/a/b", 404, "", ""},
+		{"/a%20b/x%2fy", 200, "x/y", ""},
+		{"/dirs/a%2Fb", 301, "", "http://localhost/dirs/a%2Fb/"},
+		{"/objects/a%2F..%2Fb", 200, "a/../b", ""},
+		{"/objects/../b", 301, "", "/b"},
+		// Routes created before the setting still match the decoded path.
+		{"/old/a%2Fb", 404, "", ""},
+		{"/old/c", 200, "c", ""},
+	}
+	for _, test := range tests {
+		key = ""
+		req, _ := http.NewRequest("GET", "http://localhost"+test.url, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code == 0 {
+			res.Code = 200
+		}
+		if res.Code != test.code || key != test.key || res.HeaderMap.Get("Location") != test.location {
+			t.Errorf("%s: expected code %d, key %q and location %q, got %d, %q and %q", test.url,
+				test.code, test.key, test.location, res.Code, key, res.HeaderMap.Get("Location"))
+		}
+	}
+
+	if u, err := r.Get("object").URL("key", "a/b c"); err != nil || u.String() != "/objects/a%2Fb%20c" || u.Path != "/objects/a/b c" {
+		t.Errorf("Expected encoded URL, got %v (error %v)", u, err)
+	}
+	if u, err := r.Get("space").URLPath("key", "x/y"); err != nil || u.String() != "/a%20b/x%2Fy" {
+		t.Errorf("Expected encoded URL, got %v (error %v)", u, err)
+	}
+	if _, err := r.Get("space").URL("key", "x-y"); err == nil {
+		t.Errorf("Expected error for invalid variable value")
+	}
+
+	r = NewRouter().SkipClean(true)
+	r.HandleFunc("/{key}//x", handler)
+	r.HandleFunc("/{key}/../x", handler)
+	for _, path := range []string{"/a//x", "/b/../x"} {
+		key = ""
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != 0 || key != path[1:2] {
+			t.Errorf("%s: expected a match without redirect, got code %d and key %q", path, res.Code, key)
+		}
+	}
+
+	// Strict slash redirects for paths starting with "//" stay on the host.
+	r = NewRouter().SkipClean(true).StrictSlash(true)
+	r.HandleFunc("/{path:.*}", handler)
+	for path, location := range map[string]string{
+		"//":          "/",
+		"//evil.com/": "http://example.com//evil.com",
+		"//a/?b=c":    "http://example.com//a?b=c",
+	} {
+		res := NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest("GET", path, nil))
+		if res.Code != 301 || res.HeaderMap.Get("Location") != location {
+			t.Errorf("%s: expected redirect to %q, got code %d to %q", path, location, res.Code, res.HeaderMap.Get("Location"))
+		}
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	r := NewRouter()
+	r.Host("{sub}.domain.com:{port}").Path("/sub").Name("sub")
+	r.Host("admin.domain.com:8081").Name("admin")
+	r.Host("www.domain.com").Name("www")
+	r.Host("[::1]:{port:80|443}").Name("ipv6")
+	r.Host("{ip:.+}").Name("any")
+
+	tests := []struct {
+		host  string
+		path  string
+		route string
+		vars  map[string]string
+	}{
+		{"api.domain.com:8080", "/sub", "sub", map[string]string{"sub": "api", "port": "8080"}},
+		{"api.domain.com", "/sub", "any", map[string]string{"ip": "api.domain.com"}},
+		{"api.domain.com:http", "/sub", "any", map[string]string{"ip": "api.domain.com"}},
+		{"admin.domain.com:8081", "/", "admin", map[string]string{}},
+		{"admin.domain.com:8080", "/", "any", map[string]string{"ip": "admin.domain.com"}},
+		{"admin.domain.com", "/", "any", map[string]string{"ip": "admin.domain.com"}},
+		{"www.domain.com:8080", "/", "www", map[string]string{}},
+		{"www.domain.com", "/", "www", map[string]string{}},
+		{"[::1]:443", "/", "ipv6", map[string]string{"port": "443"}},
+		{"[::1]", "/", "any", map[string]string{"ip": "[::1]"}},
+		{"[::1]:8080", "/", "any", map[string]string{"ip": "[::1]"}},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "http://localhost"+test.path, nil)
+		req.URL.Host, req.URL.Scheme = "", ""
+		req.Host = test.host
+		var match RouteMatch
+		if !r.Match(req, &match) {
+			if test.route != "" {
+				t.Errorf("%s: expected route %v, got no match", test.host, test.route)
+			}
+			continue
+		}
+		if match.Route.GetName() != test.route || !stringMapEqual(match.Vars, test.vars) {
+			t.Errorf("%s: expected route %v with vars %v, got %v with %v", test.host, test.route, test.vars, match.Route.GetName(), match.Vars)
+		}
+	}
+
+	if u, err := r.Get("sub").URL("sub", "api", "port", "8080"); err != nil || u.String() != "http://api.domain.com:8080/sub" {
+		t.Errorf("Expected URL with port, got %v (error %v)", u, err)
+	}
+	if u, err := r.Get("sub").URLHost("sub", "api", "port", "8080"); err != nil || u.String() != "http://api.domain.com:8080" {
+		t.Errorf("Expected URL with port, got %v (error %v)", u, err)
+	}
+	if _, err := r.Get("sub").URLHost("sub", "api", "port", "http"); err == nil {
+		t.Errorf("Expected error for invalid port")
+	}
+}
+
+func TestRouteGroups(t *testing.T) {
+	r := NewRouter()
+	r.Path("/list").Name("list")
+	admin := r.PathPrefix("/admin").Subrouter().NamePrefix("admin.").
+		DefaultSchemes("HTTPS").DefaultHeaders("X-Admin", "").StrictSlash(true)
+	admin.Path("/list/").Name("list")
+	users := admin.PathPrefix("/users").Subrouter().NamePrefix("users.")
+	users.Path("/list").Name("list")
+	blog := r.PathPrefix("/blog").Subrouter().NamePrefix("blog.")
+	blog.Path("/list").Name("list")
+
+	names := map[string]string{
+		"list":             "/list",
+		"admin.list":       "/admin/list/",
+		"admin.users.list": "/admin/users/list",
+		"blog.list":        "/blog/list",
+	}
+	for name, path := range names {
+		route := r.Get(name)
+		if route == nil || route.GetName() != name {
+			t.Errorf("Expected route named %q, got %v", name, route)
+			continue
+		}
+		if tpl, _ := route.GetPathTemplate(); tpl != path {
+			t.Errorf("%s: expected path %q, got %q", name, path, tpl)
+		}
+	}
+	if admin.Get("list") != r.Get("admin.list") || users.Get("list") != r.Get("admin.users.list") {
+		t.Errorf("Expected subrouters to look up names with their prefix")
+	}
+	if route := admin.Get("list"); route != nil {
+		if schemes, _ := route.GetSchemes(); len(schemes) != 1 || schemes[0] != "https" {
+			t.Errorf("Expected default schemes, got %v", schemes)
+		}
+		if headers, _ := route.GetHeaders(); len(headers) != 1 {
+			t.Errorf("Expected default headers, got %v", headers)
+		}
+	}
+
+	tests := []struct {
+		url      string
+		admin    bool
+		route    string
+		redirect bool
+	}{
+		{"https://localhost/admin/list/", true, "admin.list", false},
+		{"https://localhost/admin/list", true, "admin.list", true},
+		{"http://localhost/admin/list/", true, "", false},
+		{"https://localhost/admin/list/", false, "", false},
+		{"https://localhost/admin/users/list", true, "admin.users.list", false},
+		{"http://localhost/admin/users/list", true, "", false},
+		{"http://localhost/blog/list", false, "blog.list", false},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		if test.admin {
+			req.Header.Set("X-Admin", "1")
+		}
+		var match RouteMatch
+		if !r.Match(req, &match) {
+			if test.route != "" {
+				t.Errorf("%s: expected route %q, got no match", test.url, test.route)
+			}
+			continue
+		}
+		if match.Route.GetName() != test.route {
+			t.Errorf("%s: expected route %q, got %q", test.url, test.route, match.Route.GetName())
+		}
+		if redirect := match.Handler != nil; redirect != test.redirect {
+			t.Errorf("%s: expected redirect %v, got %v", test.url, test.redirect, redirect)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	r := NewRouter()
+	r.HandleFunc("/articles", handler("json")).Methods("GET").Accepts("application/json")
+	r.HandleFunc("/articles", handler("html")).Methods("GET").Accepts("text/html", "application/xhtml+xml")
+	r.HandleFunc("/articles", handler("create")).Methods("POST").Consumes("application/json", "text/*")
+	r.HandleFunc("/articles", handler("any")).Methods("GET")
+	s := r.PathPrefix("/api").Subrouter()
+	s.HandleFunc("/items", handler("items")).Accepts("application/json")
+	r.HandleFunc("/reports", handler("reports")).Accepts("application/json")
+	// Only competes with routes with the same templates.
+	r.PathPrefix("/").Methods("GET").Accepts("text/html").Handler(handler("fallback"))
+
+	tests := []struct {
+		method      string
+		path        string
+		accept      string
+		contentType string
+		code        int
+		body        string
+	}{
+		{"GET", "/articles", "application/json;q=0.9, text/html", "", 200, "html"},
+		{"GET", "/articles", "application/json", "", 200, "json"},
+		{"GET", "/articles", "text/*;q=0.5, application/json;q=0.4", "", 200, "html"},
+		{"GET", "/articles", "*/*;q=0.1, application/json;q=0", "", 200, "html"},
+		{"GET", "/articles", "application/xhtml+xml;q=0.8, application/json;q=0.8", "", 200, "json"},
+		{"GET", "/articles", "", "", 200, "json"},
+		{"GET", "/articles", "image/png", "", 200, "any"},
+		{"POST", "/articles", "", "application/json; charset=utf-8", 200, "create"},
+		{"POST", "/articles", "", "text/plain", 200, "create"},
+		{"POST", "/articles", "", "image/png", 415, "415 unsupported media type\n"},
+		{"POST", "/articles", "", "", 415, "415 unsupported media type\n"},
+		{"PUT", "/articles", "", "", 405, "405 method not allowed\n"},
+		{"GET", "/api/items", "image/png", "", 406, "406 not acceptable\n"},
+		{"GET", "/api/items", "Application/JSON", "", 200, "items"},
+		{"GET", "/reports", "application/json;q=0.5, text/html", "", 200, "reports"},
+		{"GET", "/other", "application/json;q=0.5, text/html", "", 200, "fallback"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != test.code || res.Body.String() != test.body {
+			t.Errorf("%s %s (Accept %q, Content-Type %q): expected %d %q, got %d %q", test.method, test.path,
+				test.accept, test.contentType, test.code, test.body, res.Code, res.Body.String())
+		}
+	}
+
+	// 406 and 415 take precedence over 405.
+	r = NewRouter()
+	r.HandleFunc("/articles", handler("json")).Methods("GET").Accepts("application/json")
+	r.HandleFunc("/articles", handler("create")).Methods("POST")
+	r.NotAcceptableHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte("custom"))
+	})
+	req, _ := http.NewRequest("GET", "http://localhost/articles", nil)
+	req.Header.Set("Accept", "text/html")
+	res := NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != 406 || res.Body.String() != "custom" {
+		t.Errorf("Expected custom 406 response, got %d %q", res.Code, res.Body.String())
+	}
+}
+
+func TestContextVars(t *testing.T) {
+	type key int
+	var vars map[string]string
+	var route *Route
+	var id interface{}
+	r := NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), key(0), "value")
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+	r.HandleFunc("/articles/{id:int}", func(w http.ResponseWriter, req *http.Request) {
+		vars, route, id = Vars(req), CurrentRoute(req), VarValue(req, "id")
+	}).Name("article")
+
+	req, _ := http.NewRequest("GET", "http://localhost/articles/42", nil)
+	r.ServeHTTP(NewRecorder(), req)
+	if vars["id"] != "42" || route != r.Get("article") || id != 42 {
+		t.Errorf("Expected vars in derived request, got %v, %v and %v", vars, route, id)
+	}
+	if Vars(req) != nil || CurrentRoute(req) != nil {
+		t.Errorf("Expected no vars in the original request")
+	}
+
+	req = SetURLVars(req, map[string]string{"id": "7"})
+	if Vars(req)["id"] != "7" || CurrentRoute(req) != nil {
+		t.Errorf("Expected vars set by SetURLVars, got %v", Vars(req))
+	}
+
+	// The request given to the handler shares the gorilla/context values of
+	// the original request, and they are cleared once served.
+	var derived *http.Request
+	var upstream interface{}
+	r = NewRouter()
+	r.HandleFunc("/store", func(w http.ResponseWriter, req *http.Request) {
+		derived = req
+		upstream = gcontext.Get(req, key(1))
+		gcontext.Set(req, key(2), "handler")
+	})
+	req, _ = http.NewRequest("GET", "http://localhost/store", nil)
+	gcontext.Set(req, key(1), "upstream")
+	r.ServeHTTP(NewRecorder(), req)
+	if derived == req || upstream != "upstream" {
+		t.Errorf("Expected upstream value in the handler, got %v", upstream)
+	}
+	if gcontext.Get(req, key(1)) != nil || gcontext.Get(derived, key(2)) != nil {
+		t.Errorf("Expected values to be cleared")
+	}
+}
+
+func TestPathPolicy(t *testing.T) {
+	var path string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+	}
+	newRouter := func(policy PathPolicy) *Router {
+		r := NewRouter().StrictSlash(true).PathPolicy(policy)
+		r.HandleFunc("/users/", handler)
+		r.HandleFunc("/items", handler)
+		r.PathPrefix("/files/").HandlerFunc(handler)
+		return r
+	}
+	tests := []struct {
+		policy   PathPolicy
+		method   string
+		url      string
+		code     int
+		location string
+		path     string
+	}{
+		{PathRedirectPermanent, "GET", "/users?page=2", 301, "http://localhost/users/?page=2", ""},
+		{PathRedirectPermanent, "POST", "/items/?a=b", 308, "http://localhost/items?a=b", ""},
+		{PathRedirectPermanent, "GET", "/a/../items?a=%2F", 301, "/items?a=%2F", ""},
+		{PathRedirectPermanent, "PUT", "//items", 308, "/items", ""},
+		{PathRedirectTemporary, "HEAD", "/users", 302, "http://localhost/users/", ""},
+		{PathRedirectTemporary, "DELETE", "/users?x", 307, "http://localhost/users/?x", ""},
+		{PathRedirectTemporary, "GET", "/./items?a", 302, "/items?a", ""},
+		{PathRedirectTemporary, "POST", "/./items", 307, "/items", ""},
+		{PathServe, "POST", "/users", 0, "", "/users"},
+		{PathServe, "GET", "/items/", 0, "", "/items/"},
+		{PathServe, "POST", "/a/../users/", 0, "", "/users/"},
+		{PathNotFound, "GET", "/users", 404, "", ""},
+		{PathNotFound, "GET", "/users/", 0, "", "/users/"},
+		{PathNotFound, "GET", "//items", 404, "", ""},
+		{PathNotFound, "GET", "/files//a/../b", 0, "", "/files//a/../b"},
+	}
+	for _, test := range tests {
+		path = ""
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.url, nil)
+		res := NewRecorder()
+		newRouter(test.policy).ServeHTTP(res, req)
+		if res.Code != test.code || res.HeaderMap.Get("Location") != test.location || path != test.path {
+			t.Errorf("%v %s %s: expected %d to %q serving %q, got %d to %q serving %q",
+				test.policy, test.method, test.url, test.code, test.location, test.path,
+				res.Code, res.HeaderMap.Get("Location"), path)
+		}
+	}
+
+	// Subrouters inherit the policy and can set their own.
+	r := NewRouter().StrictSlash(true)
+	s := r.PathPrefix("/api").Subrouter().StrictSlash(true).PathPolicy(PathServe)
+	s.HandleFunc("/users/", handler)
+	r.HandleFunc("/users/", handler)
+	res := NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost/api/users", nil)
+	if r.ServeHTTP(res, req); res.Code != 0 || path != "/api/users" {
+		t.Errorf("Expected subrouter to serve both forms, got %d", res.Code)
+	}
+	res = NewRecorder()
+	req, _ = http.NewRequest("POST", "http://localhost/users", nil)
+	if r.ServeHTTP(res, req); res.Code != 308 {
+		t.Errorf("Expected router to redirect, got %d", res.Code)
+	}
+}
+
+func TestCapturedValues(t *testing.T) {
+	var vars map[string]string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		vars = Vars(req)
+	}
+	r := NewRouter()
+	// Rejected after capturing values.
+	r.HandleFunc("/{a}/{b}", handler).Methods("POST")
+	r.HandleFunc("/{a:[a-z]+}/{b}/", handler).Queries("q", "{q}")
+	s := r.Host("{sub}.{domain}.com").Subrouter()
+	s.HandleFunc("/x/{b:[0-9]+}", handler).Headers("X-Fail", "")
+	// More regexps than values kept in a match.
+	s.HandleFunc("/{a}/{b}", handler).Queries("q1", "{q1}", "q2", "{q2}", "q3", "{q3}", "q4", "{q4}")
+	// More values than kept without allocating.
+	s.HandleFunc("/{a}/{b}/{c}/{d}/{e}/{f}/{g}", handler)
+
+	tests := []struct {
+		url  string
+		vars map[string]string
+	}{
+		{"http://localhost/x/1/?q=2", map[string]string{"a": "x", "b": "1", "q": "2"}},
+		{"http://www.domain.com/x/1?q1=1&q2=2&q3=3&q4=4", map[string]string{
+			"sub": "www", "domain": "domain", "a": "x", "b": "1",
+			"q1": "1", "q2": "2", "q3": "3", "q4": "4",
+		}},
+		{"http://www.domain.com/1/2/3/4/5/6/7", map[string]string{
+			"sub": "www", "domain": "domain", "a": "1", "b": "2", "c": "3",
+			"d": "4", "e": "5", "f": "6", "g": "7",
+		}},
+	}
+	for _, test := range tests {
+		vars = nil
+		req, _ := http.NewRequest("GET", test.url, nil)
+		r.ServeHTTP(NewRecorder(), req)
+		if !stringMapEqual(vars, test.vars) {
+			t.Errorf("%s: expected vars %v, got %v", test.url, test.vars, vars)
+		}
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Helpers
 // ----------------------------------------------------------------------------
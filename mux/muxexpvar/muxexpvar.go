@@ -0,0 +1,141 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package gorilla/mux/muxexpvar publishes metrics for the routes of a
+mux.Router through the expvar package:
+
+	r := mux.NewRouter()
+	r.Instrument(muxexpvar.NewCollector("routes").Observe)
+
+The collector publishes a map with the given name, available at
+/debug/vars as other expvar variables. It has an entry for each route,
+keyed by the route name or, for unnamed routes, by its path or host
+template, so that the number of entries doesn't depend on the requested
+URLs. Requests that don't match any route are counted under "(unmatched)".
+Each entry has:
+
+	requests     number of requests
+	bytes        total length of the response bodies
+	duration_ns  total duration of the requests, in nanoseconds
+	status       number of requests by status code
+	latency      number of requests by duration, counted in the first
+	             bucket that holds it, as in "le_50ms", or in "inf"
+*/
+package muxexpvar
+
+import (
+	"expvar"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+// DefaultBuckets are the upper bounds of the latency buckets used when none
+// are given to NewCollector().
+var DefaultBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Collector collects metrics for the routes of a router. See NewCollector().
+type Collector struct {
+	// Published metrics, by route.
+	vars *expvar.Map
+	// Upper bounds of the latency buckets, sorted, and their keys.
+	buckets []time.Duration
+	keys    []string
+	// Guards the creation of route entries.
+	mutex sync.Mutex
+}
+
+// NewCollector returns a collector publishing its metrics with the given
+// expvar name, using the given latency buckets, in increasing order, or
+// DefaultBuckets if there are none. Like expvar.Publish(), it panics if the
+// name is already used.
+//
+// Pass its Observe method to Router.Instrument() to collect the metrics of
+// the router.
+func NewCollector(name string, buckets ...time.Duration) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	c := &Collector{
+		vars:    new(expvar.Map).Init(),
+		buckets: buckets,
+		keys:    make([]string, len(buckets)),
+	}
+	for k, v := range buckets {
+		c.keys[k] = "le_" + formatDuration(v)
+	}
+	expvar.Publish(name, c.vars)
+	return c
+}
+
+// Observe adds a served request to the metrics of its route.
+func (c *Collector) Observe(info mux.RequestInfo) {
+	m := c.route(label(info.Route))
+	m.Add("requests", 1)
+	m.Add("bytes", info.Bytes)
+	m.Add("duration_ns", int64(info.Duration))
+	m.Get("status").(*expvar.Map).Add(strconv.Itoa(info.Status), 1)
+	m.Get("latency").(*expvar.Map).Add(c.bucket(info.Duration), 1)
+}
+
+// route returns the metrics of a route, creating them if needed.
+func (c *Collector) route(label string) *expvar.Map {
+	if m, ok := c.vars.Get(label).(*expvar.Map); ok {
+		return m
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if m, ok := c.vars.Get(label).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map).Init()
+	m.Set("status", new(expvar.Map).Init())
+	m.Set("latency", new(expvar.Map).Init())
+	c.vars.Set(label, m)
+	return m
+}
+
+// bucket returns the key of the latency bucket for a duration.
+func (c *Collector) bucket(d time.Duration) string {
+	for k, v := range c.buckets {
+		if d <= v {
+			return c.keys[k]
+		}
+	}
+	return "inf"
+}
+
+// label returns the key for the metrics of a route.
+func label(route *mux.Route) string {
+	if route == nil {
+		return "(unmatched)"
+	}
+	return route.Label()
+}
+
+// formatDuration formats a bucket bound without trailing zeros, as in
+// "2.5s" or "10ms".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
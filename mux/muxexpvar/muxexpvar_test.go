@@ -0,0 +1,72 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package muxexpvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("muxexpvar_test", 10*time.Millisecond, time.Minute)
+	r := mux.NewRouter().Instrument(c.Observe)
+	r.HandleFunc("/articles/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("article"))
+	}).Name("article")
+	r.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	for _, url := range []string{"/articles/1", "/articles/2", "/slow", "/missing"} {
+		req, _ := http.NewRequest("GET", "http://localhost"+url, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var got map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get("muxexpvar_test").String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	for label, m := range got {
+		if _, ok := m["duration_ns"].(float64); !ok {
+			t.Errorf("%s: expected duration, got %v", label, m["duration_ns"])
+		}
+		delete(m, "duration_ns")
+	}
+	expected := map[string]map[string]interface{}{
+		"article": {
+			"requests": 2.0, "bytes": 14.0,
+			"status":  map[string]interface{}{"200": 2.0},
+			"latency": map[string]interface{}{"le_10ms": 2.0},
+		},
+		"/slow": {
+			"requests": 1.0, "bytes": 0.0,
+			"status":  map[string]interface{}{"202": 1.0},
+			"latency": map[string]interface{}{"le_1m": 1.0},
+		},
+		"(unmatched)": {
+			"requests": 1.0, "bytes": 19.0,
+			"status":  map[string]interface{}{"404": 1.0},
+			"latency": map[string]interface{}{"le_10ms": 1.0},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if c.bucket(time.Hour) != "inf" {
+		t.Errorf("Expected last bucket for long requests")
+	}
+	if key := NewCollector("muxexpvar_test_default").keys[8]; key != "le_2.5s" {
+		t.Errorf("Expected default bucket le_2.5s, got %q", key)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package gorilla/mux/muxtest helps testing the routes registered in a
+mux.Router with tables of requests and the routes they should match:
+
+	func TestRoutes(t *testing.T) {
+		muxtest.Check(t, NewAppRouter(), []muxtest.Case{
+			{URL: "http://api.example.com/v1/users/42", Route: "user.get",
+				Vars: map[string]string{"id": "42"}},
+			{Method: "POST", URL: "/x"},
+		})
+	}
+
+For each case, a request is built and matched with Router.Match(). Cases
+with a route name expect the request to match that route, and cases
+without one expect no route to match. Failures are reported with the route
+that matched instead:
+
+	GET http://api.example.com/v1/users/42: expected route "user.get", got route "user.any"
+
+When the request matches the expected route, the URL built for the route
+with the same variables must match the same route and variables as well,
+so that Route.URL() and matching are kept consistent.
+*/
+package muxtest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+// Case is a request and the route it should match. See Check().
+type Case struct {
+	// HTTP method of the request. The default is "GET".
+	Method string
+	// URL of the request. Without a host, the request has no host.
+	URL string
+	// Headers of the request.
+	Header http.Header
+	// Route expected to match the request: its name or, for unnamed
+	// routes, its path or host template, as returned by Route.Label(). If
+	// empty, no route should match.
+	Route string
+	// Expected route variables. If nil, they are not checked.
+	Vars map[string]string
+}
+
+// String returns the method and URL of the case.
+func (c Case) String() string {
+	return c.method() + " " + c.URL
+}
+
+// method returns the HTTP method of the case.
+func (c Case) method() string {
+	if c.Method == "" {
+		return "GET"
+	}
+	return c.Method
+}
+
+// NewRequest returns the request of the case.
+func (c Case) NewRequest() (*http.Request, error) {
+	req, err := http.NewRequest(c.method(), c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// Check matches the request of each case with the router and reports the
+// differences with the expected routes and variables, calling t.Errorf().
+func Check(t testing.TB, r *mux.Router, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		if err := checkCase(r, c); err != nil {
+			t.Errorf("%v: %v", c, err)
+		}
+	}
+}
+
+// Match returns the route matched by the request of a case, and the route
+// variables. The route is nil if no route matches.
+func Match(r *mux.Router, c Case) (*mux.Route, map[string]string, error) {
+	req, err := c.NewRequest()
+	if err != nil {
+		return nil, nil, err
+	}
+	route, vars := match(r, req)
+	return route, vars, nil
+}
+
+// match matches a request with the router.
+func match(r *mux.Router, req *http.Request) (*mux.Route, map[string]string) {
+	var m mux.RouteMatch
+	if !r.Match(req, &m) {
+		return nil, nil
+	}
+	return m.Route, m.Vars
+}
+
+// checkCase returns an error if the request of a case doesn't match the
+// expected route and variables, or if the URL built for the route doesn't
+// match them.
+func checkCase(r *mux.Router, c Case) error {
+	route, vars, err := Match(r, c)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.Route == "" && route != nil:
+		return fmt.Errorf("expected no match, got route %q", route.Label())
+	case c.Route == "":
+		return nil
+	case route == nil:
+		return fmt.Errorf("expected route %q, got no match", c.Route)
+	case route.Label() != c.Route:
+		return fmt.Errorf("expected route %q, got route %q", c.Route,
+			route.Label())
+	case c.Vars != nil && !equalVars(c.Vars, vars):
+		return fmt.Errorf("expected vars %v, got %v", c.Vars, vars)
+	}
+	return checkURL(r, c, route, vars)
+}
+
+// checkURL builds the URL for a route with the given variables and returns
+// an error if it doesn't match the same route and variables.
+func checkURL(r *mux.Router, c Case, route *mux.Route,
+	vars map[string]string) error {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, name, vars[name])
+	}
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return fmt.Errorf("can't build the URL for route %q: %v",
+			route.Label(), err)
+	}
+	// The request of the case is valid, as it matched.
+	req, _ := c.NewRequest()
+	req.URL = req.URL.ResolveReference(u)
+	if u.Host != "" {
+		req.Host = u.Host
+	}
+	got, gotVars := match(r, req)
+	switch {
+	case got == nil:
+		return fmt.Errorf("URL %q built for route %q matches no route",
+			u, route.Label())
+	case got != route:
+		return fmt.Errorf("URL %q built for route %q matches route %q",
+			u, route.Label(), got.Label())
+	case !equalVars(vars, gotVars):
+		return fmt.Errorf("URL %q built for route %q matches vars %v, "+
+			"expected %v", u, route.Label(), gotVars, vars)
+	}
+	return nil
+}
+
+// equalVars returns true if both sets of variables are the same. Nil and
+// empty maps are equal.
+func equalVars(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,73 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package muxtest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+// recorder records the errors reported by Check.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {}
+
+func TestCheck(t *testing.T) {
+	r := mux.NewRouter()
+	api := r.Host("api.example.com").Subrouter()
+	api.HandleFunc("/v1/users/{id:[0-9]+}", handler).Methods("GET").Name("user.get")
+	api.HandleFunc("/v1/users/{id}", handler).Name("user.any")
+	r.HandleFunc("/articles", handler).Queries("page", "{page:int}").Name("articles")
+	r.HandleFunc("/static/{file}", handler)
+	// Builds URLs that don't match the route.
+	r.HandleFunc("/broken/{id}", handler).MatcherFunc(func(req *http.Request, m *mux.RouteMatch) bool {
+		return req.URL.Query().Get("ok") == "1"
+	}).Name("broken")
+
+	Check(t, r, []Case{
+		{URL: "http://api.example.com/v1/users/42", Route: "user.get", Vars: map[string]string{"id": "42"}},
+		{Method: "PUT", URL: "http://api.example.com/v1/users/42", Route: "user.any"},
+		{URL: "/articles?page=2", Route: "articles", Vars: map[string]string{"page": "2"}},
+		{URL: "/static/app.js", Route: "/static/{file}"},
+		{Method: "POST", URL: "/x"},
+	})
+
+	rec := &recorder{TB: t}
+	Check(rec, r, []Case{
+		{URL: "http://api.example.com/v1/users/abc", Route: "user.get"},
+		{URL: "http://api.example.com/v1/users/42", Route: "user.get", Vars: map[string]string{"id": "43"}},
+		{URL: "/articles", Route: "articles"},
+		{Method: "POST", URL: "/static/app.js"},
+		{URL: "/broken/1?ok=1", Route: "broken"},
+		{URL: "%"},
+	})
+	expected := []string{
+		`GET http://api.example.com/v1/users/abc: expected route "user.get", got route "user.any"`,
+		`GET http://api.example.com/v1/users/42: expected vars map[id:43], got map[id:42]`,
+		`GET /articles: expected route "articles", got no match`,
+		`POST /static/app.js: expected no match, got route "/static/{file}"`,
+		`GET /broken/1?ok=1: URL "/broken/1" built for route "broken" matches no route`,
+	}
+	if len(rec.errors) != len(expected)+1 {
+		t.Fatalf("Expected %d errors, got %q", len(expected)+1, rec.errors)
+	}
+	for i, e := range expected {
+		if rec.errors[i] != e {
+			t.Errorf("Expected %q, got %q", e, rec.errors[i])
+		}
+	}
+}
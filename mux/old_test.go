@@ -330,29 +330,29 @@ var pathMatcherTests = []pathMatcherTest{
 }
 
 type queryMatcherTest struct {
-	matcher queryMatcher
+	matcher *Route
 	url     string
 	result  bool
 }
 
 var queryMatcherTests = []queryMatcherTest{
 	{
-		matcher: queryMatcher(map[string]string{"foo": "bar", "baz": "ding"}),
+		matcher: new(Route).Queries("foo", "bar", "baz", "ding"),
 		url:     "http://localhost:8080/?foo=bar&baz=ding",
 		result:  true,
 	},
 	{
-		matcher: queryMatcher(map[string]string{"foo": "", "baz": ""}),
+		matcher: new(Route).Queries("foo", "", "baz", ""),
 		url:     "http://localhost:8080/?foo=anything&baz=anything",
 		result:  true,
 	},
 	{
-		matcher: queryMatcher(map[string]string{"foo": "ding", "baz": "bar"}),
+		matcher: new(Route).Queries("foo", "ding", "baz", "bar"),
 		url:     "http://localhost:8080/?foo=bar&baz=ding",
 		result:  false,
 	},
 	{
-		matcher: queryMatcher(map[string]string{"bar": "foo", "ding": "baz"}),
+		matcher: new(Route).Queries("bar", "foo", "ding", "baz"),
 		url:     "http://localhost:8080/?foo=bar&baz=ding",
 		result:  false,
 	},
@@ -735,7 +735,7 @@ func TestNewRegexp(t *testing.T) {
 	}
 
 	for pattern, paths := range tests {
-		p, _ = newRouteRegexp(pattern, false, false, false)
+		p, _ = newRouteRegexp(pattern, regexpTypePath, false, false, nil)
 		for path, result := range paths {
 			matches = p.regexp.FindStringSubmatch(path)
 			if result == nil {
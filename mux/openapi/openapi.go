@@ -0,0 +1,346 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package gorilla/mux/openapi generates OpenAPI documents describing the routes
+registered in a mux.Router, so that API documentation follows the code.
+
+Create a generator, optionally describe the routes, and generate the document:
+
+	r := mux.NewRouter()
+	g := openapi.NewGenerator("Articles API", "1.0")
+	g.Describe(r.HandleFunc("/articles/{id:[0-9]+}", ArticleHandler).
+		Methods("GET").
+		Name("getArticle"), openapi.Operation{
+		Summary: "Returns an article",
+		Tags:    []string{"articles"},
+	})
+
+	doc, err := g.Generate(r)
+
+The document follows the OpenAPI 3 specification and is encoded as JSON. Path
+templates become OpenAPI paths, like "/articles/{id}", and route variables
+become parameters, using their regexps as patterns. Each method of a route
+becomes an operation, and the route name becomes its operationId. Routes
+without methods match any method, so they are described under every
+operation.
+*/
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+// Version is the version of the OpenAPI specification followed by the
+// generated documents.
+const Version = "3.0.3"
+
+// Operation describes the operations of a route. See Generator.Describe().
+type Operation struct {
+	// Short summary of what the operation does.
+	Summary string
+	// Longer explanation of the operation behavior.
+	Description string
+	// Tags to group operations.
+	Tags []string
+}
+
+// Generator generates OpenAPI documents for routers.
+type Generator struct {
+	// Title of the API.
+	Title string
+	// Version of the API.
+	Version string
+	// Description of the API.
+	Description string
+	// Descriptions of the routes. See Generator.Describe().
+	operations map[*mux.Route]Operation
+}
+
+// NewGenerator returns a new generator for an API with the given title and
+// version.
+func NewGenerator(title, version string) *Generator {
+	return &Generator{
+		Title:      title,
+		Version:    version,
+		operations: make(map[*mux.Route]Operation),
+	}
+}
+
+// Describe sets the summary, description and tags of the operations of a
+// route, and returns the route.
+func (g *Generator) Describe(route *mux.Route, op Operation) *mux.Route {
+	g.operations[route] = op
+	return route
+}
+
+// Generate returns an OpenAPI document describing the routes of the router
+// and its subrouters, encoded as JSON.
+//
+// Only routes with a handler and a path are described. Routes without
+// methods are described under every OpenAPI operation. Methods,
+// queries and headers of the parent routes of a subrouter are used as well.
+// When several routes have the same path and method, only the first one is
+// described, as it is the one that matches.
+//
+// It returns an error if a route has an error.
+func (g *Generator) Generate(r *mux.Router) ([]byte, error) {
+	paths := make(map[string]map[string]interface{})
+	err := r.Walk(func(route *mux.Route, router *mux.Router,
+		ancestors []*mux.Route) error {
+		if err := route.GetError(); err != nil {
+			return fmt.Errorf("openapi: route %q: %v", route.Label(), err)
+		}
+		if route.GetHandler() == nil {
+			return nil
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		routes := append(ancestors[:len(ancestors):len(ancestors)], route)
+		var methods []string
+		for _, v := range routes {
+			if m, err := v.GetMethods(); err == nil {
+				methods = m
+			}
+		}
+		if methods == nil {
+			methods = operations
+		}
+		path, params := pathParameters(route, tpl)
+		params = append(params, queryParameters(route, routes)...)
+		params = append(params, headerParameters(routes)...)
+		item := paths[path]
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		for _, method := range methods {
+			method = strings.ToLower(method)
+			if !isOperation(method) || item[method] != nil {
+				continue
+			}
+			item[method] = g.operation(route, method, len(methods) > 1,
+				params)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{
+		"title":   g.Title,
+		"version": g.Version,
+	}
+	if g.Description != "" {
+		info["description"] = g.Description
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": Version,
+		"info":    info,
+		"paths":   paths,
+	}, "", "  ")
+}
+
+// operation returns the OpenAPI operation for a route method. If the route
+// has several methods, the method is added to the operationId to keep it
+// unique.
+func (g *Generator) operation(route *mux.Route, method string, suffix bool,
+	params []interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"responses": map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Default response",
+			},
+		},
+	}
+	if name := route.GetName(); name != "" {
+		if suffix {
+			name += "_" + method
+		}
+		op["operationId"] = name
+	}
+	if desc, ok := g.operations[route]; ok {
+		if desc.Summary != "" {
+			op["summary"] = desc.Summary
+		}
+		if desc.Description != "" {
+			op["description"] = desc.Description
+		}
+		if desc.Tags != nil {
+			op["tags"] = desc.Tags
+		}
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+	return op
+}
+
+// pathParameters converts a path template to an OpenAPI path, removing the
+// variable patterns, and returns the parameters for its variables.
+func pathParameters(route *mux.Route, tpl string) (string, []interface{}) {
+	patterns, _ := route.GetVarPatterns()
+	var path []byte
+	var params []interface{}
+	for len(tpl) > 0 {
+		i := strings.Index(tpl, "{")
+		if i == -1 {
+			path = append(path, tpl...)
+			break
+		}
+		path = append(path, tpl[:i]...)
+		end := closingBrace(tpl, i)
+		parts := strings.SplitN(tpl[i+1:end], ":", 2)
+		pattern := ""
+		if len(parts) == 2 {
+			pattern = parts[1]
+		}
+		path = append(path, '{')
+		path = append(path, parts[0]...)
+		path = append(path, '}')
+		params = append(params, map[string]interface{}{
+			"name":     parts[0],
+			"in":       "path",
+			"required": true,
+			"schema":   schema(pattern, patterns[parts[0]], "[^/]+"),
+		})
+		tpl = tpl[end+1:]
+	}
+	return string(path), params
+}
+
+// queryParameters returns the parameters for the query values matched by the
+// given routes, sorted by key.
+func queryParameters(route *mux.Route, routes []*mux.Route) []interface{} {
+	patterns, _ := route.GetVarPatterns()
+	queries := make(map[string]string)
+	for _, v := range routes {
+		if q, err := v.GetQueries(); err == nil {
+			for key, value := range q {
+				queries[key] = value
+			}
+		}
+	}
+	var params []interface{}
+	for _, key := range sortedKeys(queries) {
+		value := queries[key]
+		s := map[string]interface{}{"type": "string"}
+		if strings.HasPrefix(value, "{") && closingBrace(value, 0) == len(value)-1 {
+			// A single variable.
+			parts := strings.SplitN(value[1:len(value)-1], ":", 2)
+			pattern := ""
+			if len(parts) == 2 {
+				pattern = parts[1]
+			}
+			s = schema(pattern, patterns[parts[0]], ".*")
+		} else if value != "" && !strings.Contains(value, "{") {
+			s["enum"] = []string{value}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     key,
+			"in":       "query",
+			"required": true,
+			"schema":   s,
+		})
+	}
+	return params
+}
+
+// headerParameters returns the parameters for the header values matched by
+// the given routes, sorted by key. The headers that OpenAPI doesn't allow
+// as parameters are ignored.
+func headerParameters(routes []*mux.Route) []interface{} {
+	headers := make(map[string]string)
+	for _, v := range routes {
+		if h, err := v.GetHeaders(); err == nil {
+			for key, value := range h {
+				headers[key] = value
+			}
+		}
+	}
+	var params []interface{}
+	for _, key := range sortedKeys(headers) {
+		switch strings.ToLower(key) {
+		case "accept", "content-type", "authorization":
+			continue
+		}
+		s := map[string]interface{}{"type": "string"}
+		if value := headers[key]; value != "" {
+			s["enum"] = []string{value}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     key,
+			"in":       "header",
+			"required": true,
+			"schema":   s,
+		})
+	}
+	return params
+}
+
+// schema returns the schema for a variable, given the pattern from its
+// template and the expanded regexp. The default named patterns get a type
+// or format, and other patterns are used as regexps unless they are the
+// default one.
+func schema(pattern, regexp, defaultRegexp string) map[string]interface{} {
+	switch pattern {
+	case "int":
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case "uuid", "date":
+		return map[string]interface{}{"type": "string", "format": pattern}
+	}
+	s := map[string]interface{}{"type": "string"}
+	if regexp != "" && regexp != defaultRegexp {
+		s["pattern"] = "^" + regexp + "$"
+	}
+	return s
+}
+
+// closingBrace returns the index of the brace closing the one at index i,
+// or the last index if it isn't closed.
+func closingBrace(s string, i int) int {
+	level := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			level++
+		case '}':
+			if level--; level == 0 {
+				return i
+			}
+		}
+	}
+	return len(s) - 1
+}
+
+// operations are the methods of the OpenAPI operations, in lowercase.
+var operations = []string{"get", "put", "post", "delete", "options", "head",
+	"patch", "trace"}
+
+// isOperation returns true if the lowercase method is an OpenAPI operation.
+func isOperation(method string) bool {
+	for _, v := range operations {
+		if method == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,128 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/gorilla/mux"
+)
+
+func handler(w http.ResponseWriter, r *http.Request) {}
+
+func TestGenerate(t *testing.T) {
+	r := mux.NewRouter()
+	g := NewGenerator("Articles", "1.0")
+	g.Description = "Articles API"
+	g.Describe(r.HandleFunc("/articles/{category}/{id:[0-9]+}", handler).
+		Methods("GET", "PUT").
+		Name("article"), Operation{
+		Summary: "Article",
+		Tags:    []string{"articles"},
+	})
+	// Shadowed by the previous route.
+	r.HandleFunc("/articles/{category}/{id:[0-9]+}", handler).Methods("GET").Name("other")
+	r.HandleFunc("/articles", handler).
+		Methods("GET").
+		Queries("page", "{page:int}", "sort", "date", "q", "").
+		Name("articles")
+	// Not described.
+	r.Path("/no-handler").Methods("GET")
+	r.Host("{sub}.domain.com").HandlerFunc(handler).Methods("GET")
+	s := r.PathPrefix("/admin").Methods("POST").Headers("X-Admin", "", "Content-Type", "application/json").Subrouter()
+	s.HandleFunc("/users/{id:uuid}", handler).Headers("X-Version", "2")
+
+	expected := `{
+		"openapi": "3.0.3",
+		"info": {"title": "Articles", "version": "1.0", "description": "Articles API"},
+		"paths": {
+			"/articles/{category}/{id}": {
+				"get": {
+					"operationId": "article_get",
+					"summary": "Article",
+					"tags": ["articles"],
+					"responses": {"default": {"description": "Default response"}},
+					"parameters": [
+						{"name": "category", "in": "path", "required": true, "schema": {"type": "string"}},
+						{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[0-9]+$"}}
+					]
+				},
+				"put": {
+					"operationId": "article_put",
+					"summary": "Article",
+					"tags": ["articles"],
+					"responses": {"default": {"description": "Default response"}},
+					"parameters": [
+						{"name": "category", "in": "path", "required": true, "schema": {"type": "string"}},
+						{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[0-9]+$"}}
+					]
+				}
+			},
+			"/articles": {
+				"get": {
+					"operationId": "articles",
+					"responses": {"default": {"description": "Default response"}},
+					"parameters": [
+						{"name": "page", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 0}},
+						{"name": "q", "in": "query", "required": true, "schema": {"type": "string"}},
+						{"name": "sort", "in": "query", "required": true, "schema": {"type": "string", "enum": ["date"]}}
+					]
+				}
+			},
+			"/admin/users/{id}": {
+				"post": {
+					"responses": {"default": {"description": "Default response"}},
+					"parameters": [
+						{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}},
+						{"name": "X-Admin", "in": "header", "required": true, "schema": {"type": "string"}},
+						{"name": "X-Version", "in": "header", "required": true, "schema": {"type": "string", "enum": ["2"]}}
+					]
+				}
+			}
+		}
+	}`
+	doc, err := g.Generate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(doc, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected document:\n%s", doc)
+	}
+
+	r.Path("no-slash").HandlerFunc(handler)
+	if _, err := g.Generate(r); err == nil || err.Error() != `openapi: route "unnamed route": mux: path must start with a slash, got "no-slash"` {
+		t.Errorf("Expected error for route with an error, got %v", err)
+	}
+
+	// Routes without methods are described under every operation.
+	r = mux.NewRouter()
+	r.HandleFunc("/any", handler).Name("any")
+	r.HandleFunc("/any", handler).Methods("GET").Name("shadowed")
+	if doc, err = g.Generate(r); err != nil {
+		t.Fatal(err)
+	}
+	var paths struct {
+		Paths map[string]map[string]struct {
+			OperationID string
+		}
+	}
+	if err := json.Unmarshal(doc, &paths); err != nil {
+		t.Fatal(err)
+	}
+	item := paths.Paths["/any"]
+	if len(item) != len(operations) || item["get"].OperationID != "any_get" || item["trace"].OperationID != "any_trace" {
+		t.Errorf("Unexpected document:\n%s", doc)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Converter converts the values of route variables that use a named
+// pattern. See Router.Pattern().
+type Converter interface {
+	// FromString converts a value extracted from a request.
+	FromString(s string) (interface{}, error)
+	// ToString converts a value back to a string, to build URLs.
+	ToString(v interface{}) (string, error)
+}
+
+// namedPattern is a pattern registered with Router.Pattern().
+type namedPattern struct {
+	regexp    string
+	converter Converter
+}
+
+// defaultPatterns are the named patterns available in all routers.
+var defaultPatterns = map[string]*namedPattern{
+	"int":  {`[0-9]+`, intConverter{}},
+	"uuid": {`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, nil},
+	"date": {`[0-9]{4}-[0-9]{2}-[0-9]{2}`, dateConverter{}},
+}
+
+// defaultPattern returns the default named pattern with the given name.
+func defaultPattern(name string) *namedPattern {
+	return defaultPatterns[name]
+}
+
+// Pattern registers a named pattern, to be used in place of a regexp in
+// route variables. The converter is optional: if set, it converts the values
+// matched by the pattern, which can then be retrieved calling
+// mux.VarValue(). For example:
+//
+//     r := mux.NewRouter()
+//     r.Pattern("slug", "[a-z0-9-]+", nil)
+//     r.HandleFunc("/articles/{slug:slug}", ArticleHandler)
+//
+// Patterns are inherited by subrouters, and must be registered before the
+// routes that use them. The following patterns are available by default:
+//
+// - int: a non-negative integer, converted to int.
+//
+// - uuid: a UUID in its canonical form; not converted.
+//
+// - date: a date in the format YYYY-MM-DD, converted to time.Time.
+//
+// If a converter fails to convert a value, the route doesn't match.
+func (r *Router) Pattern(name, regexp string, conv Converter) *Router {
+	if r.patterns == nil {
+		r.patterns = make(map[string]*namedPattern)
+	}
+	r.patterns[name] = &namedPattern{regexp: regexp, converter: conv}
+	return r
+}
+
+// getPattern returns a named pattern registered in this router or in its
+// parents, or a default one.
+func (r *Router) getPattern(name string) *namedPattern {
+	if p := r.patterns[name]; p != nil {
+		return p
+	}
+	if r.parent != nil {
+		return r.parent.getPattern(name)
+	}
+	return defaultPattern(name)
+}
+
+// ----------------------------------------------------------------------------
+// Converters
+// ----------------------------------------------------------------------------
+
+// intConverter converts values to int.
+type intConverter struct{}
+
+func (c intConverter) FromString(s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+func (c intConverter) ToString(v interface{}) (string, error) {
+	switch i := v.(type) {
+	case int:
+		return strconv.Itoa(i), nil
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(i), nil
+	}
+	return "", fmt.Errorf("mux: expected an integer, got %T", v)
+}
+
+// dateConverter converts values to time.Time.
+type dateConverter struct{}
+
+func (c dateConverter) FromString(s string) (interface{}, error) {
+	return time.Parse("2006-01-02", s)
+}
+
+func (c dateConverter) ToString(v interface{}) (string, error) {
+	if t, ok := v.(time.Time); ok {
+		return t.Format("2006-01-02"), nil
+	}
+	return "", fmt.Errorf("mux: expected a time.Time, got %T", v)
+}
+
+// ----------------------------------------------------------------------------
+// Typed values
+// ----------------------------------------------------------------------------
+
+// VarValue returns the converted value of a route variable for the current
+// request, if its pattern has a converter.
+func VarValue(r *http.Request, name string) interface{} {
+	if m := getMatch(r); m != nil {
+		return m.values[name]
+	}
+	return nil
+}
+
+// VarInt returns the value of a route variable converted to int, as with
+// the "int" pattern. The boolean is false if there's no such value.
+func VarInt(r *http.Request, name string) (int, bool) {
+	i, ok := VarValue(r, name).(int)
+	return i, ok
+}
+
+// VarTime returns the value of a route variable converted to time.Time, as
+// with the "date" pattern. The boolean is false if there's no such value.
+func VarTime(r *http.Request, name string) (time.Time, bool) {
+	t, ok := VarValue(r, name).(time.Time)
+	return t, ok
+}
+
+// TypedURL builds a URL for the route, like Route.URL(), but accepts values
+// of any type for the route variables.
+//
+// Values for variables using a named pattern with a converter are converted
+// to strings by the converter. Strings are used as they are, and other values
+// are formatted using fmt.Sprint(). For example:
+//
+//     r.HandleFunc("/articles/{id:int}", ArticleHandler).Name("article")
+//     url, err := r.Get("article").TypedURL("id", 42)
+func (r *Route) TypedURL(pairs ...interface{}) (*url.URL, error) {
+	s, err := r.stringPairs(pairs)
+	if err != nil {
+		return nil, err
+	}
+	return r.URL(s...)
+}
+
+// stringPairs converts typed values of route variables to strings, using
+// the converters of their patterns if they have one.
+func (r *Route) stringPairs(pairs []interface{}) ([]string, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf(
+			"mux: number of parameters must be multiple of 2, got %v", pairs)
+	}
+	converters := r.getConverters()
+	s := make([]string, len(pairs))
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("mux: variable name must be a string, got %v",
+				pairs[i])
+		}
+		s[i] = name
+		switch v := pairs[i+1].(type) {
+		case string:
+			s[i+1] = v
+		default:
+			if c := converters[name]; c != nil {
+				value, err := c.ToString(v)
+				if err != nil {
+					return nil, err
+				}
+				s[i+1] = value
+			} else {
+				s[i+1] = fmt.Sprint(v)
+			}
+		}
+	}
+	return s, nil
+}
+
+// getConverters returns the converters for the route variables, by name.
+func (r *Route) getConverters() map[string]Converter {
+	converters := make(map[string]Converter)
+	if r.regexp != nil {
+		all := append([]*routeRegexp{r.regexp.host, r.regexp.path},
+			r.regexp.queries...)
+		for _, rr := range all {
+			if rr != nil && rr.varsC != nil {
+				for k, c := range rr.varsC {
+					if c != nil {
+						converters[rr.varsN[k]] = c
+					}
+				}
+			}
+		}
+	}
+	return converters
+}
@@ -0,0 +1,115 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type upperConverter struct{}
+
+func (c upperConverter) FromString(s string) (interface{}, error) {
+	return strings.ToUpper(s), nil
+}
+
+func (c upperConverter) ToString(v interface{}) (string, error) {
+	return strings.ToLower(v.(string)), nil
+}
+
+func TestNamedPatterns(t *testing.T) {
+	var id, code interface{}
+	var date time.Time
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, _ = VarInt(r, "id")
+		date, _ = VarTime(r, "date")
+		code = VarValue(r, "code")
+	}
+	r := NewRouter()
+	r.Pattern("code", "[a-z]{3}", upperConverter{})
+	r.HandleFunc("/articles/{id:int}", handler).Name("article")
+	r.HandleFunc("/archive/{date:date}", handler).Name("archive")
+	r.HandleFunc("/keys/{key:uuid}", handler).Name("key")
+	// Patterns are inherited by subrouters.
+	s := r.PathPrefix("/countries").Subrouter()
+	s.HandleFunc("/{code:code}", handler).Name("country")
+
+	tests := []struct {
+		url    string
+		status int
+		vars   map[string]string
+	}{
+		{"/articles/42", 200, map[string]string{"id": "42"}},
+		{"/articles/foo", 404, nil},
+		// Too big for an int.
+		{"/articles/99999999999999999999999", 404, nil},
+		{"/archive/2012-10-03", 200, map[string]string{"date": "2012-10-03"}},
+		{"/archive/2012-13-03", 404, nil},
+		{"/keys/0e3e58dc-8f1c-4bd2-a5b3-2e5dc1a7c3a4", 200, map[string]string{"key": "0e3e58dc-8f1c-4bd2-a5b3-2e5dc1a7c3a4"}},
+		{"/keys/0e3e58dc", 404, nil},
+		{"/countries/bra", 200, map[string]string{"code": "bra"}},
+		{"/countries/brazil", 404, nil},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "http://localhost"+test.url, nil)
+		rsp := NewRecorder()
+		r.ServeHTTP(rsp, req)
+		if (rsp.Code == http.StatusNotFound) != (test.status == http.StatusNotFound) {
+			t.Errorf("%s: expected status %v, got %v", test.url, test.status, rsp.Code)
+		}
+		var match RouteMatch
+		if r.Match(req, &match) && !stringMapEqual(match.Vars, test.vars) {
+			t.Errorf("%s: expected vars %v, got %v", test.url, test.vars, match.Vars)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/articles/42", nil)
+	r.ServeHTTP(NewRecorder(), req)
+	if id != 42 {
+		t.Errorf("Expected id 42, got %v", id)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost/archive/2012-10-03", nil)
+	r.ServeHTTP(NewRecorder(), req)
+	if expected := time.Date(2012, 10, 3, 0, 0, 0, 0, time.UTC); !date.Equal(expected) {
+		t.Errorf("Expected date %v, got %v", expected, date)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost/countries/bra", nil)
+	r.ServeHTTP(NewRecorder(), req)
+	if code != "BRA" {
+		t.Errorf("Expected code BRA, got %v", code)
+	}
+}
+
+func TestTypedURL(t *testing.T) {
+	r := NewRouter()
+	r.Pattern("code", "[a-z]{3}", upperConverter{})
+	r.Path("/articles/{id:int}/{date:date}/{code:code}/{page}").Name("article")
+
+	tests := []struct {
+		pairs []interface{}
+		url   string
+	}{
+		{[]interface{}{"id", 42, "date", time.Date(2012, 10, 3, 0, 0, 0, 0, time.UTC), "code", "bra", "page", 2}, "/articles/42/2012-10-03/bra/2"},
+		// Strings are used as they are.
+		{[]interface{}{"id", "42", "date", "2012-10-03", "code", "bra", "page", "2"}, "/articles/42/2012-10-03/bra/2"},
+		// Errors.
+		{[]interface{}{"id", 42.5, "date", "2012-10-03", "code", "bra", "page", "2"}, ""},
+		{[]interface{}{"id", 42, "date", 2012, "code", "bra", "page", "2"}, ""},
+		{[]interface{}{"id", 42, "date"}, ""},
+		{[]interface{}{42, "id"}, ""},
+	}
+	for _, test := range tests {
+		u, err := r.Get("article").TypedURL(test.pairs...)
+		if test.url == "" {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %v", test.pairs, u)
+			}
+		} else if err != nil || u.String() != test.url {
+			t.Errorf("%v: expected %v, got %v (error %v)", test.pairs, test.url, u, err)
+		}
+	}
+}
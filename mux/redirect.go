@@ -0,0 +1,111 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedirectTo sets a handler for the route that redirects requests to the
+// route registered with the given name, using the given status code. The
+// variables of the matched request are used to build the URL of the target
+// route, and the query string of the request is kept:
+//
+//     r.HandleFunc("/articles/{category}/{id:[0-9]+}", ArticleHandler).
+//       Name("article")
+//     r.Path("/blog/{category}/{id:[0-9]+}").
+//       RedirectTo("article", http.StatusMovedPermanently)
+//
+// Here, "/blog/go/42?page=2" is redirected to "/articles/go/42?page=2".
+//
+// The name is prefixed by the name prefix of the router, as in Route.Name().
+// The target route is retrieved when a request is redirected, so it can be
+// registered later. If it doesn't exist, or if its URL can't be built from
+// the request values, the response is "404 Not Found". Router.Validate()
+// reports redirects to unknown routes.
+func (r *Route) RedirectTo(name string, code int) *Route {
+	return r.RedirectToFunc(name, code, nil)
+}
+
+// RedirectToFunc is like Route.RedirectTo(), but the variables of the target
+// route are returned by f, given the variables of the matched request. This
+// is used when variables are renamed:
+//
+//     r.Path("/blog/{slug}").RedirectToFunc("article", http.StatusFound,
+//       func(vars map[string]string) map[string]string {
+//         return map[string]string{"id": vars["slug"]}
+//       })
+//
+// If f is nil, the variables are used as they are.
+func (r *Route) RedirectToFunc(name string, code int,
+	f func(vars map[string]string) map[string]string) *Route {
+	if r.err != nil {
+		return r
+	}
+	r.redirectTo = r.getNamePrefix() + name
+	target := r.redirectTo
+	return r.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		vars := make(map[string]string)
+		for k, v := range Vars(req) {
+			vars[k] = v
+		}
+		if f != nil {
+			vars = f(vars)
+		}
+		u, err := r.redirectURL(target, vars, req.URL)
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		http.Redirect(w, req, u.String(), code)
+	})
+}
+
+// redirectURL returns the URL of the named route, built with the given
+// variables, keeping the query values of the original URL that the route
+// doesn't set as they were sent.
+func (r *Route) redirectURL(name string, vars map[string]string,
+	orig *url.URL) (*url.URL, error) {
+	names, lock := r.getNamedRoutes()
+	lock.RLock()
+	target := names[name]
+	lock.RUnlock()
+	if target == nil {
+		return nil, fmt.Errorf("mux: route %q not found", name)
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, k, v)
+	}
+	u, err := target.URL(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	if u.RawQuery == "" {
+		u.RawQuery = orig.RawQuery
+	} else if orig.RawQuery != "" {
+		query := u.Query()
+		var extra []string
+		for _, v := range strings.Split(orig.RawQuery, "&") {
+			key := v
+			if i := strings.IndexByte(key, '='); i >= 0 {
+				key = key[:i]
+			}
+			if k, err := url.QueryUnescape(key); err == nil {
+				key = k
+			}
+			if _, ok := query[key]; !ok && v != "" {
+				extra = append(extra, v)
+			}
+		}
+		if len(extra) > 0 {
+			u.RawQuery += "&" + strings.Join(extra, "&")
+		}
+	}
+	return u, nil
+}
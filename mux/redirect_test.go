@@ -0,0 +1,59 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirectTo(t *testing.T) {
+	r := NewRouter()
+	r.Path("/blog/{category}/{id:[0-9]+}").RedirectTo("article", http.StatusMovedPermanently)
+	r.Path("/posts/{slug}").RedirectToFunc("article", http.StatusFound,
+		func(vars map[string]string) map[string]string {
+			return map[string]string{"category": "misc", "id": vars["slug"]}
+		})
+	r.HandleFunc("/articles/{category}/{id:[0-9]+}", func(w http.ResponseWriter, req *http.Request) {}).
+		Name("article")
+	r.Path("/old/list").RedirectTo("list", http.StatusMovedPermanently)
+	r.Path("/old/missing").RedirectTo("missing", http.StatusMovedPermanently)
+	s := r.PathPrefix("/v2").Subrouter().NamePrefix("v2.")
+	s.Path("/list").Queries("page", "{page}").Name("list")
+	s.Path("/legacy").Queries("p", "{page}").RedirectTo("list", http.StatusTemporaryRedirect)
+
+	tests := []struct {
+		url      string
+		code     int
+		location string
+	}{
+		{"/blog/go/42", 301, "/articles/go/42"},
+		{"/blog/go/42?page=2&sort=date", 301, "/articles/go/42?page=2&sort=date"},
+		{"/posts/7?a=%2F", 302, "/articles/misc/7?a=%2F"},
+		// Invalid value for the target route.
+		{"/posts/abc", 404, ""},
+		{"/old/missing", 404, ""},
+		// Query values set by the target route win.
+		{"/v2/legacy?p=3&page=1&lang=en", 307, "/v2/list?page=3&p=3&lang=en"},
+		// Other query values are kept as they were sent.
+		{"/v2/legacy?p=3&q=a+b%2f&x", 307, "/v2/list?page=3&p=3&q=a+b%2f&x"},
+		{"/old/list?page=1", 404, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "http://localhost"+test.url, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != test.code || res.HeaderMap.Get("Location") != test.location {
+			t.Errorf("%s: expected %d to %q, got %d to %q", test.url, test.code,
+				test.location, res.Code, res.HeaderMap.Get("Location"))
+		}
+	}
+
+	errs := r.Validate()
+	if len(errs) != 2 || errs[0].Error() != `mux: route "/old/list" redirects to unknown route "list"` ||
+		errs[1].Error() != `mux: route "/old/missing" redirects to unknown route "missing"` {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
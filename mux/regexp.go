@@ -13,8 +13,17 @@ import (
 	"strings"
 )
 
+// regexpType is the part of the request matched by a routeRegexp.
+type regexpType int
+
+const (
+	regexpTypePath regexpType = iota
+	regexpTypeHost
+	regexpTypeQuery
+)
+
 // newRouteRegexp parses a route template and returns a routeRegexp,
-// used to match a host or path.
+// used to match a host, path or query value.
 //
 // It will extract named variables, assemble a regexp to be matched, create
 // a "reverse" template to build URLs and compile regexps to validate variable
@@ -23,7 +32,15 @@ import (
 // Previously we accepted only Python-like identifiers for variable
 // names ([a-zA-Z_][a-zA-Z0-9_]*), but currently the only restriction is that
 // name and pattern can't be empty, and names can't contain a colon.
-func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*routeRegexp, error) {
+//
+// A pattern can be the name of a pattern registered using Router.Pattern(),
+// as in {id:int}: patterns returns the definition for a name, if any. If
+// patterns is nil only the default named patterns are used.
+func newRouteRegexp(tpl string, typ regexpType, matchPrefix, strictSlash bool,
+	patterns func(string) *namedPattern) (*routeRegexp, error) {
+	if patterns == nil {
+		patterns = defaultPattern
+	}
 	// Check if it is well-formed.
 	idxs, errBraces := braceIndices(tpl)
 	if errBraces != nil {
@@ -33,9 +50,12 @@ func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*rout
 	template := tpl
 	// Now let's parse it.
 	defaultPattern := "[^/]+"
-	if matchHost {
+	if typ == regexpTypeHost {
 		defaultPattern = "[^.]+"
 		matchPrefix, strictSlash = false, false
+	} else if typ == regexpTypeQuery {
+		defaultPattern = ".*"
+		matchPrefix, strictSlash = false, false
 	}
 	if matchPrefix {
 		strictSlash = false
@@ -46,8 +66,19 @@ func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*rout
 		tpl = tpl[:len(tpl)-1]
 		endSlash = true
 	}
+	// Hosts with a port are matched including the port. Port variables
+	// match numbers by default.
+	portIdx := -1
+	if typ == regexpTypeHost {
+		portIdx = hostPortIndex(tpl)
+	}
+	sep := typ.separator()
+	// Variables using the default pattern and taking whole segments can be
+	// matched without regexps. Check if this is true for all of them.
+	simple := sep != 0
 	varsN := make([]string, len(idxs)/2)
 	varsR := make([]*regexp.Regexp, len(idxs)/2)
+	var varsC []Converter
 	pattern := bytes.NewBufferString("^")
 	reverse := bytes.NewBufferString("")
 	var end int
@@ -59,18 +90,35 @@ func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*rout
 		parts := strings.SplitN(tpl[idxs[i]+1:end-1], ":", 2)
 		name := parts[0]
 		patt := defaultPattern
+		if portIdx != -1 && idxs[i] > portIdx {
+			patt = "[0-9]+"
+		}
 		if len(parts) == 2 {
 			patt = parts[1]
+			simple = false
+		} else if (idxs[i] > 0 && tpl[idxs[i]-1] != sep) ||
+			(end < len(tpl) && tpl[end] != sep) {
+			simple = false
 		}
 		// Name or pattern can't be empty.
 		if name == "" || patt == "" {
 			return nil, fmt.Errorf("mux: missing name or pattern in %q",
 				tpl[idxs[i]:end])
 		}
+		// Expand named patterns.
+		if np := patterns(patt); np != nil {
+			patt = np.regexp
+			if np.converter != nil {
+				if varsC == nil {
+					varsC = make([]Converter, len(idxs)/2)
+				}
+				varsC[i/2] = np.converter
+			}
+		}
 		// Build the regexp pattern.
 		fmt.Fprintf(pattern, "%s(%s)", regexp.QuoteMeta(raw), patt)
 		// Build the reverse template.
-		fmt.Fprintf(reverse, "%s%%s", raw)
+		fmt.Fprintf(reverse, "%s%%s", strings.Replace(raw, "%", "%%", -1))
 		// Append variable name and compiled pattern.
 		varsN[i/2] = name
 		varsR[i/2], err = regexp.Compile(fmt.Sprintf("^%s$", patt))
@@ -87,7 +135,7 @@ func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*rout
 	if !matchPrefix {
 		pattern.WriteByte('$')
 	}
-	reverse.WriteString(raw)
+	reverse.WriteString(strings.Replace(raw, "%", "%%", -1))
 	if endSlash {
 		reverse.WriteByte('/')
 	}
@@ -96,40 +144,219 @@ func newRouteRegexp(tpl string, matchHost, matchPrefix, strictSlash bool) (*rout
 	if errCompile != nil {
 		return nil, errCompile
 	}
+	var segments []tplSegment
+	if simple {
+		segments = newTplSegments(tpl, sep)
+	}
 	// Done!
 	return &routeRegexp{
-		template:  template,
-		matchHost: matchHost,
-		regexp:    reg,
-		reverse:   reverse.String(),
-		varsN:     varsN,
-		varsR:     varsR,
+		template:    template,
+		regexpType:  typ,
+		withPort:    portIdx != -1,
+		matchPrefix: matchPrefix,
+		strictSlash: strictSlash,
+		regexp:      reg,
+		segments:    segments,
+		reverse:     reverse.String(),
+		varsN:       varsN,
+		varsR:       varsR,
+		varsC:       varsC,
 	}, nil
 }
 
-// routeRegexp stores a regexp to match a host or path and information to
-// collect and validate route variables.
+// routeRegexp stores a regexp to match a host, path or query value and
+// information to collect and validate route variables.
 type routeRegexp struct {
 	// The unmodified template.
 	template string
-	// True for host match, false for path match.
-	matchHost bool
+	// The part of the request to match.
+	regexpType regexpType
+	// For query values, the query key.
+	queryKey string
+	// For hosts, true if the template has a port.
+	withPort bool
+	// True to match a path prefix instead of the whole path.
+	matchPrefix bool
+	// True to accept an optional trailing slash.
+	strictSlash bool
+	// True to match the encoded path. See Router.UseEncodedPath().
+	useEncodedPath bool
 	// Expanded regexp.
 	regexp *regexp.Regexp
+	// Template segments, used instead of the regexp when all variables
+	// take whole segments and use the default pattern. Nil otherwise.
+	segments []tplSegment
 	// Reverse template.
 	reverse string
 	// Variable names.
 	varsN []string
 	// Variable regexps (validators).
 	varsR []*regexp.Regexp
+	// Variable converters, from named patterns. Nil if there are none.
+	varsC []Converter
 }
 
-// Match matches the regexp against the URL host or path.
+// Match matches the regexp against the URL host, path or query value.
+//
+// The variable values are extracted at the same time and kept in the match,
+// so that routeRegexpGroup.setMatch() doesn't have to extract them again.
 func (r *routeRegexp) Match(req *http.Request, match *RouteMatch) bool {
-	if !r.matchHost {
-		return r.regexp.MatchString(req.URL.Path)
+	switch r.regexpType {
+	case regexpTypeHost:
+		return r.matchCapture(getHost(req, r.withPort), match)
+	case regexpTypeQuery:
+		values := r.queryValues(req, match)
+		if values == nil {
+			return false
+		}
+		match.capture(r, values)
+		return true
+	}
+	return r.matchCapture(r.requestPath(req), match)
+}
+
+// matchCapture returns true if the host or path s matches, keeping the
+// variable values in the match.
+func (r *routeRegexp) matchCapture(s string, match *RouteMatch) bool {
+	if len(r.varsN) == 0 || match.numCaptures == maxCaptures {
+		return r.matchString(s)
+	}
+	var values []string
+	if r.segments != nil {
+		i, n := match.numValues, len(r.varsN)
+		buffered := i+n <= maxCapturedValues
+		if buffered {
+			values = match.valueBuf[i : i : i+n]
+		} else {
+			values = make([]string, 0, n)
+		}
+		if !r.matchSegments(s, &values) {
+			return false
+		}
+		if buffered {
+			match.numValues += n
+		}
+	} else {
+		m := r.regexp.FindStringSubmatch(s)
+		if m == nil {
+			return false
+		}
+		values = m[1:]
+	}
+	match.capture(r, values)
+	return true
+}
+
+// requestPath returns the request path to match: the encoded one if the
+// regexp uses it, or the decoded one otherwise.
+func (r *routeRegexp) requestPath(req *http.Request) string {
+	return getPath(req, r.useEncodedPath)
+}
+
+func (r *routeRegexp) explain(req *http.Request) string {
+	switch r.regexpType {
+	case regexpTypeHost:
+		return fmt.Sprintf("host %q doesn't match the template %q",
+			getHost(req, r.withPort), r.template)
+	case regexpTypeQuery:
+		values, ok := req.URL.Query()[r.queryKey]
+		if !ok {
+			return fmt.Sprintf("query key %q is missing", r.queryKey)
+		}
+		return fmt.Sprintf("query values %q for %q don't match the template %q",
+			values, r.queryKey, r.template)
+	}
+	if r.matchPrefix {
+		return fmt.Sprintf("path %q doesn't match the prefix template %q",
+			r.requestPath(req), r.template)
+	}
+	return fmt.Sprintf("path %q doesn't match the template %q",
+		r.requestPath(req), r.template)
+}
+
+// queryValues returns the variable values extracted from the first value
+// of the query key that matches, or nil if none matches. An empty template
+// matches any value.
+func (r *routeRegexp) queryValues(req *http.Request, m *RouteMatch) []string {
+	for _, v := range m.getQuery(req)[r.queryKey] {
+		if r.template == "" {
+			return []string{}
+		}
+		if values := r.values(v); values != nil {
+			return values
+		}
+	}
+	return nil
+}
+
+// matchString returns true if the host or path s matches.
+func (r *routeRegexp) matchString(s string) bool {
+	if r.segments != nil {
+		return r.matchSegments(s, nil)
+	}
+	return r.regexp.MatchString(s)
+}
+
+// values returns the variable values extracted from the host or path s,
+// or nil if it doesn't match.
+func (r *routeRegexp) values(s string) []string {
+	if len(r.varsN) == 0 {
+		if r.matchString(s) {
+			return []string{}
+		}
+		return nil
 	}
-	return r.regexp.MatchString(getHost(req))
+	if r.segments != nil {
+		values := make([]string, 0, len(r.varsN))
+		if r.matchSegments(s, &values) {
+			return values
+		}
+		return nil
+	}
+	if m := r.regexp.FindStringSubmatch(s); m != nil {
+		return m[1:]
+	}
+	return nil
+}
+
+// matchSegments matches the host or path s against the template segments.
+// It behaves exactly like the regexp built for the same template. If values
+// is not nil, the variable values are appended to it.
+func (r *routeRegexp) matchSegments(s string, values *[]string) bool {
+	sep := r.regexpType.separator()
+	if r.strictSlash && strings.HasSuffix(s, "/") {
+		s = s[:len(s)-1]
+	}
+	last := len(r.segments) - 1
+	pos := 0
+	for i, seg := range r.segments {
+		if pos > len(s) {
+			// No segments left.
+			return false
+		}
+		end := strings.IndexByte(s[pos:], sep)
+		if end == -1 {
+			end = len(s)
+		} else {
+			end += pos
+		}
+		part := s[pos:end]
+		pos = end + 1
+		if seg.isVar {
+			if part == "" {
+				return false
+			}
+			if values != nil {
+				*values = append(*values, part)
+			}
+		} else if part != seg.value {
+			if i != last || !r.matchPrefix || !strings.HasPrefix(part, seg.value) {
+				return false
+			}
+		}
+	}
+	// Everything must be consumed, unless this is a prefix.
+	return r.matchPrefix || pos > len(s)
 }
 
 // url builds a URL part using the given values.
@@ -144,6 +371,10 @@ func (r *routeRegexp) url(pairs ...string) (string, error) {
 		if !ok {
 			return "", fmt.Errorf("mux: missing route variable %q", v)
 		}
+		if r.useEncodedPath {
+			value = url.PathEscape(value)
+			values[v] = value
+		}
 		urlValues[k] = value
 	}
 	rv := fmt.Sprintf(r.reverse, urlValues...)
@@ -162,6 +393,23 @@ func (r *routeRegexp) url(pairs ...string) (string, error) {
 	return rv, nil
 }
 
+// urlPath builds a URL path using the given values. For regexps matching the
+// encoded path, the values are escaped and the encoded path is returned as
+// well, if it differs from the decoded one.
+func (r *routeRegexp) urlPath(pairs ...string) (path, rawPath string, err error) {
+	if path, err = r.url(pairs...); err != nil || !r.useEncodedPath {
+		return path, "", err
+	}
+	rawPath = path
+	if path, err = url.PathUnescape(rawPath); err != nil {
+		return "", "", err
+	}
+	if path == rawPath {
+		rawPath = ""
+	}
+	return path, rawPath, nil
+}
+
 // braceIndices returns the first level curly brace indices from a string.
 // It returns an error in case of unbalanced braces.
 func braceIndices(s string) ([]int, error) {
@@ -187,61 +435,322 @@ func braceIndices(s string) ([]int, error) {
 	return idxs, nil
 }
 
+// separator returns the character that separates segments in the matched
+// part of the request, or zero if it is not split in segments.
+func (t regexpType) separator() byte {
+	switch t {
+	case regexpTypePath:
+		return '/'
+	case regexpTypeHost:
+		return '.'
+	}
+	return 0
+}
+
+// tplSegment is a segment of a host or path template: a literal value or a
+// variable using the default pattern.
+type tplSegment struct {
+	value string
+	isVar bool
+}
+
+// newTplSegments splits a template in segments. It must only be called when
+// all variables take whole segments and use the default pattern.
+func newTplSegments(tpl string, sep byte) []tplSegment {
+	parts := strings.Split(tpl, string(sep))
+	segments := make([]tplSegment, len(parts))
+	for k, v := range parts {
+		if strings.HasPrefix(v, "{") {
+			segments[k].isVar = true
+		} else {
+			segments[k].value = v
+		}
+	}
+	return segments
+}
+
 // ----------------------------------------------------------------------------
 // routeRegexpGroup
 // ----------------------------------------------------------------------------
 
 // routeRegexpGroup groups the route matchers that carry variables.
 type routeRegexpGroup struct {
-	host *routeRegexp
-	path *routeRegexp
+	host    *routeRegexp
+	path    *routeRegexp
+	queries []*routeRegexp
 }
 
-// setMatch extracts the variables from the URL once a route matches.
-func (v *routeRegexpGroup) setMatch(req *http.Request, m *RouteMatch, r *Route) {
-	// Store host variables.
+// checkVars returns an error if the variables of a new matcher are already
+// used by others, except the one it replaces.
+func (v *routeRegexpGroup) checkVars(rr *routeRegexp) error {
+	for k, name := range rr.varsN {
+		if err := uniqueVars(rr.varsN[k+1:], []string{name}); err != nil {
+			return err
+		}
+	}
+	if v.host != nil && rr.regexpType != regexpTypeHost {
+		if err := uniqueVars(rr.varsN, v.host.varsN); err != nil {
+			return err
+		}
+	}
+	if v.path != nil && rr.regexpType != regexpTypePath {
+		if err := uniqueVars(rr.varsN, v.path.varsN); err != nil {
+			return err
+		}
+	}
+	for _, q := range v.queries {
+		if err := uniqueVars(rr.varsN, q.varsN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryString builds the query string for the query values, in the order
+// they were defined.
+func (v *routeRegexpGroup) queryString(pairs ...string) (string, error) {
+	var buf bytes.Buffer
+	for _, q := range v.queries {
+		value, err := q.url(pairs...)
+		if err != nil {
+			return "", err
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(url.QueryEscape(q.queryKey))
+		buf.WriteByte('=')
+		buf.WriteString(url.QueryEscape(value))
+	}
+	return buf.String(), nil
+}
+
+// numVars returns the number of variables of the group.
+func (v *routeRegexpGroup) numVars() int {
+	if v == nil {
+		return 0
+	}
+	n := 0
 	if v.host != nil {
-		hostVars := v.host.regexp.FindStringSubmatch(getHost(req))
+		n += len(v.host.varsN)
+	}
+	if v.path != nil {
+		n += len(v.path.varsN)
+	}
+	for _, q := range v.queries {
+		n += len(q.varsN)
+	}
+	return n
+}
+
+// setMatch extracts the variables from the URL once a route matches. The
+// values captured while matching are used if there are any.
+//
+// It returns why the route doesn't match after all, or an empty string if it
+// does. See Route.explainMatch().
+func (v *routeRegexpGroup) setMatch(req *http.Request, m *RouteMatch, r *Route) string {
+	// Store host variables.
+	if v.host != nil && len(v.host.varsN) > 0 {
+		hostVars, ok := m.captured(v.host)
+		if !ok {
+			hostVars = v.host.values(getHost(req, v.host.withPort))
+		}
 		if hostVars != nil {
-			for k, v := range v.host.varsN {
-				m.Vars[v] = hostVars[k+1]
+			if !v.host.setVars(m, hostVars) {
+				return reasonRejected
 			}
 		}
 	}
 	// Store path variables.
 	if v.path != nil {
-		pathVars := v.path.regexp.FindStringSubmatch(req.URL.Path)
+		pathVars, ok := m.captured(v.path)
+		if !ok {
+			pathVars = v.path.values(v.path.requestPath(req))
+		}
 		if pathVars != nil {
-			for k, v := range v.path.varsN {
-				m.Vars[v] = pathVars[k+1]
+			if v.path.useEncodedPath {
+				// Decode the variables taken from the encoded path.
+				for k, value := range pathVars {
+					var err error
+					if pathVars[k], err = url.PathUnescape(value); err != nil {
+						return "a variable value has an invalid escape sequence"
+					}
+				}
+			}
+			if !v.path.setVars(m, pathVars) {
+				return reasonRejected
 			}
 			// Check if we should redirect.
 			if r.strictSlash {
 				p1 := strings.HasSuffix(req.URL.Path, "/")
 				p2 := strings.HasSuffix(v.path.template, "/")
-				if p1 != p2 {
-					u, _ := url.Parse(req.URL.String())
+				if p1 != p2 && r.pathPolicy == PathNotFound {
+					return "the path differs by the trailing slash and the policy is PathNotFound"
+				}
+				if p1 != p2 && r.pathPolicy != PathServe {
+					u := *req.URL
 					if p1 {
 						u.Path = u.Path[:len(u.Path)-1]
+						if strings.HasSuffix(u.RawPath, "/") {
+							u.RawPath = u.RawPath[:len(u.RawPath)-1]
+						}
 					} else {
 						u.Path += "/"
+						if u.RawPath != "" {
+							u.RawPath += "/"
+						}
+					}
+					if u.Host == "" && strings.HasPrefix(u.Path, "//") {
+						// A relative location starting with "//" would
+						// point to another host.
+						u.Scheme = requestScheme(req, false)
+						u.Host = requestHost(req, false)
 					}
-					m.Handler = http.RedirectHandler(u.String(), 301)
+					m.Handler = http.RedirectHandler(u.String(),
+						r.pathPolicy.redirectCode(req.Method))
 				}
 			}
 		}
 	}
+	// Store query variables.
+	for _, q := range v.queries {
+		queryVars, ok := m.captured(q)
+		if !ok {
+			queryVars = q.queryValues(req, m)
+		}
+		if queryVars != nil {
+			if !q.setVars(m, queryVars) {
+				return reasonRejected
+			}
+		}
+	}
+	return ""
 }
 
-// getHost tries its best to return the request host.
-func getHost(r *http.Request) string {
-	if !r.URL.IsAbs() {
-		host := r.Host
-		// Slice off any port information.
-		if i := strings.Index(host, ":"); i != -1 {
-			host = host[:i]
+// reasonRejected tells that a variable value couldn't be converted by its
+// named pattern.
+const reasonRejected = "a variable value was rejected by its named pattern"
+
+// maxCaptures is the number of regexps whose values are kept in a match, and
+// maxCapturedValues the number of values kept without allocating. This is
+// enough for most routes; values of other regexps are extracted again once
+// the route matches.
+const (
+	maxCaptures       = 4
+	maxCapturedValues = 8
+)
+
+// capture holds the variable values extracted by a regexp while matching.
+type capture struct {
+	regexp *routeRegexp
+	values []string
+}
+
+// capture keeps the values extracted by a regexp, if there's room for them.
+func (m *RouteMatch) capture(r *routeRegexp, values []string) {
+	if m.numCaptures < maxCaptures {
+		m.captures[m.numCaptures] = capture{regexp: r, values: values}
+		m.numCaptures++
+	}
+}
+
+// getQuery returns the parsed query of the request, parsing it only once
+// for all the routes.
+func (m *RouteMatch) getQuery(req *http.Request) url.Values {
+	if m.query == nil || m.rawQuery != req.URL.RawQuery {
+		m.query, m.rawQuery = req.URL.Query(), req.URL.RawQuery
+	}
+	return m.query
+}
+
+// captured returns the values extracted by a regexp while matching. The
+// boolean is false if they were not kept.
+func (m *RouteMatch) captured(r *routeRegexp) ([]string, bool) {
+	for i := m.numCaptures - 1; i >= 0; i-- {
+		if m.captures[i].regexp == r {
+			return m.captures[i].values, true
+		}
+	}
+	return nil, false
+}
+
+// setVars stores the variable values extracted from a request, converting
+// them if their patterns have a converter. It returns false if a value
+// can't be converted.
+func (r *routeRegexp) setVars(m *RouteMatch, values []string) bool {
+	for k, name := range r.varsN {
+		m.Vars[name] = values[k]
+		if r.varsC != nil && r.varsC[k] != nil {
+			value, err := r.varsC[k].FromString(values[k])
+			if err != nil {
+				return false
+			}
+			if m.values == nil {
+				m.values = make(map[string]interface{})
+			}
+			m.values[name] = value
+		}
+	}
+	return true
+}
+
+// getPath returns the request path, encoded if requested. The encoded path
+// keeps escaped characters like "%2F" as they were sent by the client.
+func getPath(req *http.Request, encoded bool) string {
+	if encoded {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.Path
+}
+
+// getHost tries its best to return the request host. The port is removed
+// unless withPort is true.
+func getHost(r *http.Request, withPort bool) string {
+	host := r.Host
+	if r.URL.IsAbs() {
+		host = r.URL.Host
+	}
+	if !withPort {
+		host = stripPort(host)
+	}
+	return host
+}
+
+// stripPort removes the port from a host, if any. IPv6 addresses must be
+// enclosed in square brackets, as in "[::1]:8080".
+func stripPort(host string) string {
+	if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+		return host[:i]
+	}
+	return host
+}
+
+// hostPortIndex returns the index of the colon before the port in a host
+// template, or -1 if the template has no port. Colons inside variables and
+// IPv6 addresses are ignored.
+func hostPortIndex(tpl string) int {
+	idx := -1
+	var level int
+	var brackets bool
+	for i := 0; i < len(tpl); i++ {
+		switch tpl[i] {
+		case '{':
+			level++
+		case '}':
+			level--
+		case '[':
+			if level == 0 {
+				brackets = true
+			}
+		case ']':
+			if level == 0 {
+				brackets = false
+			}
+		case ':':
+			if level == 0 && !brackets {
+				idx = i
+			}
 		}
-		return host
 	}
-	return r.URL.Host
+	return idx
 }
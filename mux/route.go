@@ -7,17 +7,23 @@ package mux
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Route stores information to match a request and build URLs.
 type Route struct {
 	// Parent where the route was registered (a Router).
 	parent parentRoute
-	// Request handler for the route.
-	handler http.Handler
+	// Request handler for the route, stored as a routeHandler so that it
+	// can be replaced while serving requests. See Router.SetHandler().
+	handler atomic.Value
 	// List of matchers.
 	matchers []matcher
 	// Manager for the variables from host and path.
@@ -25,10 +31,23 @@ type Route struct {
 	// If true, when the path pattern is "/path/", accessing "/path" will
 	// redirect to the former and vice versa.
 	strictSlash bool
+	// If true, the route matches the encoded path.
+	// See Router.UseEncodedPath().
+	useEncodedPath bool
+	// How requests for the other form of a strict slash path are handled.
+	// See Router.PathPolicy().
+	pathPolicy PathPolicy
+	// If true, the route was created by Router.DetachedRoute() and wasn't
+	// added to the router yet. Its name isn't registered until it is.
+	detached bool
 	// If true, this route never matches: it is only used to build URLs.
 	buildOnly bool
 	// The name used to build URLs.
 	name string
+	// Name of the route requests are redirected to. See Route.RedirectTo().
+	redirectTo string
+	// Metadata values. See Route.Meta().
+	meta map[interface{}]interface{}
 	// Error resulted from building a route.
 	err error
 }
@@ -38,25 +57,75 @@ func (r *Route) Match(req *http.Request, match *RouteMatch) bool {
 	if r.buildOnly || r.err != nil {
 		return false
 	}
+	// Keep what we got so far, in case the route doesn't match in the end.
+	route, handler, vars, values := match.Route, match.Handler, match.Vars,
+		match.values
+	captures, buffered := match.numCaptures, match.numValues
+	var methods methodMatcher
+	var mediaErr error
 	// Match everything.
 	for _, m := range r.matchers {
 		if matched := m.Match(req, match); !matched {
+			// Check the other matchers anyway for the method and media
+			// types: if all of them match, the request is only rejected
+			// because of these.
+			switch m := m.(type) {
+			case methodMatcher:
+				if methods == nil {
+					methods = m
+				}
+				continue
+			case consumeMatcher:
+				mediaErr = ErrUnsupportedMediaType
+				continue
+			case acceptMatcher:
+				if mediaErr == nil {
+					mediaErr = ErrNotAcceptable
+				}
+				continue
+			}
+			match.numCaptures, match.numValues = captures, buffered
 			return false
 		}
 	}
+	if methods != nil || mediaErr != nil {
+		match.numCaptures, match.numValues = captures, buffered
+	}
+	if methods != nil {
+		match.Route, match.Handler, match.Vars = route, handler, vars
+		match.setMatchErr(ErrMethodMismatch)
+		match.addAllowed(methods)
+		if match.cors == nil {
+			match.cors = r.getCORS()
+		}
+		return false
+	}
+	if mediaErr != nil {
+		match.Route, match.Handler, match.Vars = route, handler, vars
+		match.setMatchErr(mediaErr)
+		return false
+	}
 	// Yay, we have a match. Let's collect some info about it.
+	matchErr := match.MatchErr
+	match.MatchErr = nil
 	if match.Route == nil {
 		match.Route = r
 	}
 	if match.Handler == nil {
-		match.Handler = r.handler
+		match.Handler = r.GetHandler()
 	}
 	if match.Vars == nil {
-		match.Vars = make(map[string]string)
+		match.Vars = make(map[string]string, r.regexp.numVars())
 	}
 	// Set variables.
-	if r.regexp != nil {
-		r.regexp.setMatch(req, match, r)
+	if r.regexp != nil && r.regexp.setMatch(req, match, r) != "" {
+		// A value couldn't be converted by its pattern or unescaped, or the
+		// path differs by the trailing slash with the PathNotFound policy:
+		// no match.
+		match.Route, match.Handler, match.Vars = route, handler, vars
+		match.values, match.MatchErr = values, matchErr
+		match.numCaptures, match.numValues = captures, buffered
+		return false
 	}
 	return true
 }
@@ -81,7 +150,7 @@ func (r *Route) BuildOnly() *Route {
 // Handler sets a handler for the route.
 func (r *Route) Handler(handler http.Handler) *Route {
 	if r.err == nil {
-		r.handler = handler
+		r.handler.Store(routeHandler{handler})
 	}
 	return r
 }
@@ -93,30 +162,233 @@ func (r *Route) HandlerFunc(f func(http.ResponseWriter, *http.Request)) *Route {
 
 // GetHandler returns the handler for the route, if any.
 func (r *Route) GetHandler() http.Handler {
-	return r.handler
+	h, _ := r.handler.Load().(routeHandler)
+	return h.Handler
+}
+
+// routeHandler wraps the handler of a route, as the values stored in an
+// atomic.Value must have the same type.
+type routeHandler struct {
+	http.Handler
 }
 
 // Name -----------------------------------------------------------------------
 
 // Name sets the name for the route, used to build URLs.
 // If the name was registered already it will be overwritten.
+//
+// The name is prefixed by the name prefix of the router where the route was
+// registered. See Router.NamePrefix().
 func (r *Route) Name(name string) *Route {
 	if r.name != "" {
 		r.err = fmt.Errorf("mux: route already has name %q, can't set %q",
 			r.name, name)
 	}
 	if r.err == nil {
-		r.name = name
-		r.getNamedRoutes()[name] = r
+		r.name = r.getNamePrefix() + name
+		if !r.isDetached() {
+			r.registerName()
+		}
 	}
 	return r
 }
 
-// GetName returns the name for the route, if any.
+// registerName registers the route name in the router.
+func (r *Route) registerName() {
+	names, lock := r.getNamedRoutes()
+	lock.Lock()
+	names[r.name] = r
+	lock.Unlock()
+}
+
+// GetName returns the name for the route, if any, including the name prefix.
 func (r *Route) GetName() string {
 	return r.name
 }
 
+// Label returns the route name, or its path or host template if it has no
+// name, to identify the route in messages, logs or metrics.
+func (r *Route) Label() string {
+	switch {
+	case r.name != "":
+		return r.name
+	case r.regexp != nil && r.regexp.path != nil:
+		return r.regexp.path.template
+	case r.regexp != nil && r.regexp.host != nil:
+		return r.regexp.host.template
+	}
+	return "unnamed route"
+}
+
+// Meta -----------------------------------------------------------------------
+
+// Meta sets a metadata value for the route, like the authorization scopes
+// it requires or its cache policy. Middlewares can read it for the matched
+// route:
+//
+//     r.HandleFunc("/admin/users", UsersHandler).Meta("scope", "admin")
+//
+//     func authMiddleware(next http.Handler) http.Handler {
+//         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//             scope, _ := mux.CurrentRoute(r).GetMeta("scope").(string)
+//             // ...
+//         })
+//     }
+//
+// Routes in a subrouter inherit the metadata of their parent route and of
+// the subrouter, and can override it. See Router.Meta().
+func (r *Route) Meta(key, value interface{}) *Route {
+	if r.meta == nil {
+		r.meta = make(map[interface{}]interface{})
+	}
+	r.meta[key] = value
+	return r
+}
+
+// GetMeta returns the metadata value for the given key set for the route or
+// inherited from its parents, or nil.
+func (r *Route) GetMeta(key interface{}) interface{} {
+	value, _ := r.getMeta(key)
+	return value
+}
+
+// Introspection --------------------------------------------------------------
+
+// The methods below return the definitions of a route, as given to its
+// matchers. They return an error if the route has an error or doesn't
+// define the requested attribute.
+//
+// Host and path templates include the ones inherited from the parent routes
+// of a subrouter. Other matchers defined in parent routes are not included:
+// they can be retrieved from the ancestors passed by Router.Walk().
+
+// GetPathTemplate returns the path template used to match the route.
+func (r *Route) GetPathTemplate() (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	if r.regexp == nil || r.regexp.path == nil {
+		return "", errors.New("mux: route doesn't have a path")
+	}
+	return r.regexp.path.template, nil
+}
+
+// GetHostTemplate returns the host template used to match the route.
+func (r *Route) GetHostTemplate() (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	if r.regexp == nil || r.regexp.host == nil {
+		return "", errors.New("mux: route doesn't have a host")
+	}
+	return r.regexp.host.template, nil
+}
+
+// GetMethods returns the HTTP methods accepted by the route.
+func (r *Route) GetMethods() ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var methods []string
+	for _, m := range r.matchers {
+		if mm, ok := m.(methodMatcher); ok {
+			methods = append(methods, mm...)
+		}
+	}
+	if methods == nil {
+		return nil, errors.New("mux: route doesn't have methods")
+	}
+	return methods, nil
+}
+
+// GetSchemes returns the URL schemes accepted by the route.
+func (r *Route) GetSchemes() ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var schemes []string
+	for _, m := range r.matchers {
+		if sm, ok := m.(schemeMatcher); ok {
+			schemes = append(schemes, sm...)
+		}
+	}
+	if schemes == nil {
+		return nil, errors.New("mux: route doesn't have schemes")
+	}
+	return schemes, nil
+}
+
+// GetQueries returns the URL query values matched by the route, as
+// key/value pairs. An empty value means that any value is accepted.
+func (r *Route) GetQueries() (map[string]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var queries map[string]string
+	for _, m := range r.matchers {
+		if rr, ok := m.(*routeRegexp); ok && rr.regexpType == regexpTypeQuery {
+			if queries == nil {
+				queries = make(map[string]string)
+			}
+			queries[rr.queryKey] = rr.template
+		}
+	}
+	if queries == nil {
+		return nil, errors.New("mux: route doesn't have queries")
+	}
+	return queries, nil
+}
+
+// GetHeaders returns the header values matched by the route, as key/value
+// pairs. An empty value means that any value is accepted.
+func (r *Route) GetHeaders() (map[string]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var headers map[string]string
+	for _, m := range r.matchers {
+		if hm, ok := m.(headerMatcher); ok {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			for k, v := range hm {
+				headers[k] = v
+			}
+		}
+	}
+	if headers == nil {
+		return nil, errors.New("mux: route doesn't have headers")
+	}
+	return headers, nil
+}
+
+// GetVarPatterns returns the regexp patterns of the route variables, from
+// the host, path and query templates, by variable name. Named patterns are
+// expanded, so {id:int} gives "[0-9]+".
+func (r *Route) GetVarPatterns() (map[string]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	patterns := make(map[string]string)
+	if r.regexp != nil {
+		for _, rr := range append([]*routeRegexp{r.regexp.host, r.regexp.path},
+			r.regexp.queries...) {
+			if rr == nil {
+				continue
+			}
+			for k, name := range rr.varsN {
+				// Remove the anchors added to the validators.
+				p := rr.varsR[k].String()
+				patterns[name] = p[1 : len(p)-1]
+			}
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("mux: route doesn't have variables")
+	}
+	return patterns, nil
+}
+
 // ----------------------------------------------------------------------------
 // Matchers
 // ----------------------------------------------------------------------------
@@ -124,53 +396,256 @@ func (r *Route) GetName() string {
 // matcher types try to match a request.
 type matcher interface {
 	Match(*http.Request, *RouteMatch) bool
+	// explain tells why the request doesn't match. See Router.Explain().
+	explain(*http.Request) string
 }
 
 // addMatcher adds a matcher to the route.
 func (r *Route) addMatcher(m matcher) *Route {
 	if r.err == nil {
 		r.matchers = append(r.matchers, m)
+		if router, ok := r.parent.(*Router); ok && !r.detached {
+			// Matchers are used to index routes.
+			router.resetIndex()
+		}
 	}
 	return r
 }
 
-// addRegexpMatcher adds a host or path matcher and builder to a route.
-func (r *Route) addRegexpMatcher(tpl string, matchHost, matchPrefix bool) error {
+// addRegexpMatcher adds a host, path or query matcher and builder to a
+// route. For queries, the template has the form "key=value".
+func (r *Route) addRegexpMatcher(tpl string, typ regexpType, matchPrefix bool) error {
 	if r.err != nil {
 		return r.err
 	}
 	r.regexp = r.getRegexpGroup()
-	if !matchHost {
+	var key string
+	switch typ {
+	case regexpTypePath:
 		if len(tpl) == 0 || tpl[0] != '/' {
 			return fmt.Errorf("mux: path must start with a slash, got %q", tpl)
 		}
 		if r.regexp.path != nil {
 			tpl = strings.TrimRight(r.regexp.path.template, "/") + tpl
 		}
+	case regexpTypeQuery:
+		if i := strings.Index(tpl, "="); i != -1 {
+			key, tpl = tpl[:i], tpl[i+1:]
+		}
 	}
-	rr, err := newRouteRegexp(tpl, matchHost, matchPrefix, r.strictSlash)
+	rr, err := newRouteRegexp(tpl, typ, matchPrefix, r.strictSlash,
+		r.getPattern)
 	if err != nil {
 		return err
 	}
-	if matchHost {
-		if r.regexp.path != nil {
-			if err = uniqueVars(rr.varsN, r.regexp.path.varsN); err != nil {
-				return err
-			}
-		}
+	rr.useEncodedPath = typ == regexpTypePath && r.useEncodedPath
+	if err = r.regexp.checkVars(rr); err != nil {
+		return err
+	}
+	switch typ {
+	case regexpTypeHost:
 		r.regexp.host = rr
-	} else {
-		if r.regexp.host != nil {
-			if err = uniqueVars(rr.varsN, r.regexp.host.varsN); err != nil {
-				return err
-			}
-		}
+	case regexpTypePath:
 		r.regexp.path = rr
+	case regexpTypeQuery:
+		rr.queryKey = key
+		r.regexp.queries = append(r.regexp.queries, rr)
 	}
 	r.addMatcher(rr)
 	return nil
 }
 
+// Accepts --------------------------------------------------------------------
+
+// acceptMatcher matches the request against the media types it accepts.
+type acceptMatcher []string
+
+func (m acceptMatcher) Match(r *http.Request, match *RouteMatch) bool {
+	return m.quality(r) > 0
+}
+
+func (m acceptMatcher) explain(r *http.Request) string {
+	return fmt.Sprintf("Accept header %q doesn't accept %s",
+		r.Header.Get("Accept"), strings.Join(m, ", "))
+}
+
+// quality returns the best quality value given by the Accept header of the
+// request to the media types of the matcher, or 0 if none is accepted.
+func (m acceptMatcher) quality(r *http.Request) float64 {
+	ranges := parseAccept(r.Header["Accept"])
+	if ranges == nil {
+		// No header: anything is accepted.
+		return 1
+	}
+	var best float64
+	for _, v := range m {
+		if q := acceptQuality(ranges, v); q > best {
+			best = q
+		}
+	}
+	return best
+}
+
+// Accepts adds a matcher for the media types accepted by the client, from
+// the Accept header. It accepts a sequence of one or more media types, e.g.:
+// "application/json", "text/html".
+//
+// The route matches if the Accept header gives a quality value above zero to
+// one of the media types, or if the request doesn't have the header. When
+// several routes registered in the same router with the same host and path
+// templates match a request this way, the one with the best quality value
+// wins. For example:
+//
+//     r := mux.NewRouter()
+//     r.HandleFunc("/articles", JSONHandler).Accepts("application/json")
+//     r.HandleFunc("/articles", HTMLHandler).Accepts("text/html")
+//
+// Here, a request with the header "Accept: application/json;q=0.9,
+// text/html" is handled by HTMLHandler.
+//
+// When no route matches but some route would match if it accepted another
+// media type, the response is "406 Not Acceptable".
+// See Router.NotAcceptableHandler.
+func (r *Route) Accepts(mediaTypes ...string) *Route {
+	for k, v := range mediaTypes {
+		mediaTypes[k] = strings.ToLower(v)
+	}
+	return r.addMatcher(acceptMatcher(mediaTypes))
+}
+
+// quality returns the quality value given by the request to the route, if
+// it negotiates the response media type, or -1 otherwise.
+func (r *Route) quality(req *http.Request) float64 {
+	for _, m := range r.matchers {
+		if am, ok := m.(acceptMatcher); ok {
+			return am.quality(req)
+		}
+	}
+	return -1
+}
+
+// sameTemplates returns true if both routes have the same host and path
+// templates, so that they match the same URLs and only differ by the media
+// types they negotiate.
+func (r *Route) sameTemplates(b *Route) bool {
+	var host, path, bHost, bPath *routeRegexp
+	if r.regexp != nil {
+		host, path = r.regexp.host, r.regexp.path
+	}
+	if b.regexp != nil {
+		bHost, bPath = b.regexp.host, b.regexp.path
+	}
+	return sameTemplate(host, bHost) && sameTemplate(path, bPath)
+}
+
+// sameTemplate returns true if both regexps are nil or have the same
+// template and type of match.
+func sameTemplate(a, b *routeRegexp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.template == b.template && a.matchPrefix == b.matchPrefix
+}
+
+// mediaRange is a media range from an Accept header.
+type mediaRange struct {
+	// The media type, possibly with wildcards, e.g. "text/*".
+	mediaType string
+	// The quality value.
+	q float64
+}
+
+// parseAccept parses the values of an Accept header. Invalid media ranges
+// are ignored. It returns nil if there are no valid media ranges.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if v == "*" {
+				// Sent by some clients, meaning "*/*".
+				v = "*/*"
+			}
+			mediaType, params, err := mime.ParseMediaType(v)
+			if err != nil || !strings.Contains(mediaType, "/") {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality value given to a media type by the most
+// specific media range that matches it, or 0 if none does.
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	var q float64
+	best := -1
+	for _, r := range ranges {
+		specificity := -1
+		switch {
+		case r.mediaType == mediaType:
+			specificity = 2
+		case strings.HasSuffix(r.mediaType, "/*") && r.mediaType != "*/*" &&
+			strings.HasPrefix(mediaType, r.mediaType[:len(r.mediaType)-1]):
+			specificity = 1
+		case r.mediaType == "*/*":
+			specificity = 0
+		}
+		if specificity > best {
+			q, best = r.q, specificity
+		}
+	}
+	return q
+}
+
+// Consumes -------------------------------------------------------------------
+
+// consumeMatcher matches the request against content types.
+type consumeMatcher []string
+
+func (m consumeMatcher) Match(r *http.Request, match *RouteMatch) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, v := range m {
+		if v == mediaType || v == "*/*" || (strings.HasSuffix(v, "/*") &&
+			strings.HasPrefix(mediaType, v[:len(v)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m consumeMatcher) explain(r *http.Request) string {
+	return fmt.Sprintf("Content-Type header %q is not one of %s",
+		r.Header.Get("Content-Type"), strings.Join(m, ", "))
+}
+
+// Consumes adds a matcher for the content type of the request, from the
+// Content-Type header. It accepts a sequence of one or more media types,
+// e.g.: "application/json", "text/*". Parameters of the request content
+// type, like the charset, are ignored.
+//
+// When no route matches but some route would match if it accepted another
+// content type, the response is "415 Unsupported Media Type".
+// See Router.UnsupportedMediaTypeHandler.
+func (r *Route) Consumes(mediaTypes ...string) *Route {
+	for k, v := range mediaTypes {
+		mediaTypes[k] = strings.ToLower(v)
+	}
+	return r.addMatcher(consumeMatcher(mediaTypes))
+}
+
 // Headers --------------------------------------------------------------------
 
 // headerMatcher matches the request against header values.
@@ -180,6 +655,24 @@ func (m headerMatcher) Match(r *http.Request, match *RouteMatch) bool {
 	return matchMap(m, r.Header, true)
 }
 
+func (m headerMatcher) explain(r *http.Request) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if matchMap(map[string]string{k: m[k]}, r.Header, true) {
+			continue
+		}
+		if r.Header[http.CanonicalHeaderKey(k)] == nil {
+			return fmt.Sprintf("header %q is missing", k)
+		}
+		return fmt.Sprintf("header %q doesn't have the value %q", k, m[k])
+	}
+	return "headers don't match"
+}
+
 // Headers adds a matcher for request header values.
 // It accepts a sequence of key/value pairs to be matched. For example:
 //
@@ -216,10 +709,17 @@ func (r *Route) Headers(pairs ...string) *Route {
 //     r.Host("{subdomain}.domain.com")
 //     r.Host("{subdomain:[a-z]+}.domain.com")
 //
+// The port of the request is ignored, unless the template has one:
+//
+//     r.Host("www.domain.com:8080")
+//     r.Host("{subdomain}.domain.com:{port}")
+//
+// Port variables match numbers by default.
+//
 // Variable names must be unique in a given route. They can be retrieved
 // calling mux.Vars(request).
 func (r *Route) Host(tpl string) *Route {
-	r.err = r.addRegexpMatcher(tpl, true, false)
+	r.err = r.addRegexpMatcher(tpl, regexpTypeHost, false)
 	return r
 }
 
@@ -232,6 +732,10 @@ func (m MatcherFunc) Match(r *http.Request, match *RouteMatch) bool {
 	return m(r, match)
 }
 
+func (m MatcherFunc) explain(r *http.Request) string {
+	return "custom matcher function returned false"
+}
+
 // MatcherFunc adds a custom function to be used as request matcher.
 func (r *Route) MatcherFunc(f MatcherFunc) *Route {
 	return r.addMatcher(f)
@@ -246,6 +750,27 @@ func (m methodMatcher) Match(r *http.Request, match *RouteMatch) bool {
 	return matchInArray(m, r.Method)
 }
 
+func (m methodMatcher) explain(r *http.Request) string {
+	return fmt.Sprintf("method %q is not one of %s", r.Method,
+		strings.Join(m, ", "))
+}
+
+// anyMethod returns true if neither the route nor its parent routes have a
+// matcher for HTTP methods.
+func (r *Route) anyMethod() bool {
+	for _, m := range r.matchers {
+		if _, ok := m.(methodMatcher); ok {
+			return false
+		}
+	}
+	if router, ok := r.parent.(*Router); ok {
+		if route, ok := router.parent.(*Route); ok {
+			return route.anyMethod()
+		}
+	}
+	return true
+}
+
 // Methods adds a matcher for HTTP methods.
 // It accepts a sequence of one or more methods to be matched, e.g.:
 // "GET", "POST", "PUT".
@@ -277,7 +802,7 @@ func (r *Route) Methods(methods ...string) *Route {
 // Variable names must be unique in a given route. They can be retrieved
 // calling mux.Vars(request).
 func (r *Route) Path(tpl string) *Route {
-	r.err = r.addRegexpMatcher(tpl, false, false)
+	r.err = r.addRegexpMatcher(tpl, regexpTypePath, false)
 	return r
 }
 
@@ -286,19 +811,12 @@ func (r *Route) Path(tpl string) *Route {
 // PathPrefix adds a matcher for the URL path prefix.
 func (r *Route) PathPrefix(tpl string) *Route {
 	r.strictSlash = false
-	r.err = r.addRegexpMatcher(tpl, false, true)
+	r.err = r.addRegexpMatcher(tpl, regexpTypePath, true)
 	return r
 }
 
 // Query ----------------------------------------------------------------------
 
-// queryMatcher matches the request against URL queries.
-type queryMatcher map[string]string
-
-func (m queryMatcher) Match(r *http.Request, match *RouteMatch) bool {
-	return matchMap(m, r.URL.Query(), false)
-}
-
 // Queries adds a matcher for URL query values.
 // It accepts a sequence of key/value pairs. For example:
 //
@@ -309,11 +827,26 @@ func (m queryMatcher) Match(r *http.Request, match *RouteMatch) bool {
 // values, e.g.: ?foo=bar&baz=ding.
 //
 // It the value is an empty string, it will match any value if the key is set.
+//
+// Values can have variables, like host and path templates. Variables match
+// anything by default:
+//
+//     r.Queries("page", "{page:[0-9]+}", "q", "{q}")
+//
+// Variable names must be unique in a given route. They can be retrieved
+// calling mux.Vars(request), and are added to the query string of URLs
+// built for the route.
 func (r *Route) Queries(pairs ...string) *Route {
 	if r.err == nil {
-		var queries map[string]string
-		queries, r.err = mapFromPairs(pairs...)
-		return r.addMatcher(queryMatcher(queries))
+		if len(pairs)%2 != 0 {
+			r.err = fmt.Errorf(
+				"mux: number of parameters must be multiple of 2, got %v", pairs)
+			return r
+		}
+		for i := 0; i < len(pairs) && r.err == nil; i += 2 {
+			r.err = r.addRegexpMatcher(pairs[i]+"="+pairs[i+1],
+				regexpTypeQuery, false)
+		}
 	}
 	return r
 }
@@ -327,6 +860,11 @@ func (m schemeMatcher) Match(r *http.Request, match *RouteMatch) bool {
 	return matchInArray(m, r.URL.Scheme)
 }
 
+func (m schemeMatcher) explain(r *http.Request) string {
+	return fmt.Sprintf("scheme %q is not one of %s", r.URL.Scheme,
+		strings.Join(m, ", "))
+}
+
 // Schemes adds a matcher for URL schemes.
 // It accepts a sequence schemes to be matched, e.g.: "http", "https".
 func (r *Route) Schemes(schemes ...string) *Route {
@@ -351,7 +889,9 @@ func (r *Route) Schemes(schemes ...string) *Route {
 // Here, the routes registered in the subrouter won't be tested if the host
 // doesn't match.
 func (r *Route) Subrouter() *Router {
-	router := &Router{parent: r, strictSlash: r.strictSlash}
+	router := &Router{parent: r, strictSlash: r.strictSlash,
+		useEncodedPath: r.useEncodedPath, pathPolicy: r.pathPolicy}
+	router.namedRoutes, router.namesLock = r.getNamedRoutes()
 	r.addMatcher(router)
 	return router
 }
@@ -377,7 +917,11 @@ func (r *Route) Subrouter() *Router {
 //
 //     "/articles/technology/42"
 //
-// This also works for host variables:
+// Query values defined with Route.Queries() are added to the query string,
+// in the order they were defined.
+//
+// This also works for host variables. The scheme is the first one defined
+// with Route.Schemes(), or "http" if none is:
 //
 //     r := mux.NewRouter()
 //     r.Host("{subdomain}.domain.com").
@@ -391,6 +935,10 @@ func (r *Route) Subrouter() *Router {
 //
 // All variables defined in the route are required, and their values must
 // conform to the corresponding patterns.
+//
+// To add a fragment, set the Fragment field of the returned URL. See
+// Route.URLQuery() to add other query values and Route.AbsoluteURL() to
+// build URLs that always have a scheme and host.
 func (r *Route) URL(pairs ...string) (*url.URL, error) {
 	if r.err != nil {
 		return nil, r.err
@@ -398,24 +946,32 @@ func (r *Route) URL(pairs ...string) (*url.URL, error) {
 	if r.regexp == nil {
 		return nil, errors.New("mux: route doesn't have a host or path")
 	}
-	var scheme, host, path string
+	var scheme, host, path, rawPath string
 	var err error
 	if r.regexp.host != nil {
-		// Set a default scheme.
-		scheme = "http"
 		if host, err = r.regexp.host.url(pairs...); err != nil {
 			return nil, err
 		}
+		if scheme = r.getScheme(); scheme == "" {
+			// Set a default scheme.
+			scheme = "http"
+		}
 	}
 	if r.regexp.path != nil {
-		if path, err = r.regexp.path.url(pairs...); err != nil {
+		if path, rawPath, err = r.regexp.path.urlPath(pairs...); err != nil {
 			return nil, err
 		}
 	}
+	query, err := r.regexp.queryString(pairs...)
+	if err != nil {
+		return nil, err
+	}
 	return &url.URL{
-		Scheme: scheme,
-		Host:   host,
-		Path:   path,
+		Scheme:   scheme,
+		Host:     host,
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: query,
 	}, nil
 }
 
@@ -433,8 +989,12 @@ func (r *Route) URLHost(pairs ...string) (*url.URL, error) {
 	if err != nil {
 		return nil, err
 	}
+	scheme := r.getScheme()
+	if scheme == "" {
+		scheme = "http"
+	}
 	return &url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   host,
 	}, nil
 }
@@ -449,27 +1009,131 @@ func (r *Route) URLPath(pairs ...string) (*url.URL, error) {
 	if r.regexp == nil || r.regexp.path == nil {
 		return nil, errors.New("mux: route doesn't have a path")
 	}
-	path, err := r.regexp.path.url(pairs...)
+	path, rawPath, err := r.regexp.path.urlPath(pairs...)
 	if err != nil {
 		return nil, err
 	}
 	return &url.URL{
-		Path: path,
+		Path:    path,
+		RawPath: rawPath,
 	}, nil
 }
 
+// URLQuery builds a URL for the route like Route.URL() does, and adds the
+// given values to the query string, after the ones defined with
+// Route.Queries(). For example:
+//
+//     url, err := r.Get("articles").URLQuery(url.Values{"page": {"2"}},
+//                                            "category", "technology")
+//
+// ...returns a URL with the path "/articles/technology" and the query
+// "page=2".
+func (r *Route) URLQuery(query url.Values, pairs ...string) (*url.URL, error) {
+	u, err := r.URL(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	if extra := query.Encode(); extra != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += extra
+	}
+	return u, nil
+}
+
+// AbsoluteURL builds a URL for the route like Route.URL() does, using the
+// given request to set the scheme and host when the route doesn't define
+// them. This is useful to build links for emails or redirects.
+//
+// The scheme is "https" for requests received over TLS and "http" otherwise,
+// and the host is the one requested by the client. When the router runs
+// behind a reverse proxy, call Router.TrustProxyHeaders(true) to use the
+// X-Forwarded-Proto and X-Forwarded-Host headers set by the proxy instead.
+func (r *Route) AbsoluteURL(req *http.Request, pairs ...string) (*url.URL, error) {
+	u, err := r.URL(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	trust := r.getTrustProxyHeaders()
+	if u.Scheme = r.getScheme(); u.Scheme == "" {
+		u.Scheme = requestScheme(req, trust)
+	}
+	if u.Host == "" {
+		u.Host = requestHost(req, trust)
+	}
+	return u, nil
+}
+
+// requestScheme returns the scheme used for a request.
+func requestScheme(req *http.Request, trust bool) string {
+	if trust {
+		if proto := forwardedValue(req, "X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(proto)
+		}
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestHost returns the host requested by the client.
+func requestHost(req *http.Request, trust bool) string {
+	if trust {
+		if host := forwardedValue(req, "X-Forwarded-Host"); host != "" {
+			return host
+		}
+	}
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// forwardedValue returns the first value of a header set by proxies, which
+// append their values separated by commas.
+func forwardedValue(req *http.Request, name string) string {
+	value := req.Header.Get(name)
+	if i := strings.Index(value, ","); i != -1 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
+
+// getScheme returns the first scheme defined for the route or its parent
+// routes, or an empty string if none is.
+func (r *Route) getScheme() string {
+	for _, m := range r.matchers {
+		if sm, ok := m.(schemeMatcher); ok && len(sm) > 0 {
+			return sm[0]
+		}
+	}
+	if r.parent == nil {
+		return ""
+	}
+	return r.parent.getScheme()
+}
+
 // ----------------------------------------------------------------------------
 // parentRoute
 // ----------------------------------------------------------------------------
 
 // parentRoute allows routes to know about parent host and path definitions.
 type parentRoute interface {
-	getNamedRoutes() map[string]*Route
+	getNamedRoutes() (map[string]*Route, *sync.RWMutex)
 	getRegexpGroup() *routeRegexpGroup
+	getPattern(name string) *namedPattern
+	getCORS() *CORSOptions
+	getScheme() string
+	getTrustProxyHeaders() bool
+	getNamePrefix() string
+	getMeta(key interface{}) (interface{}, bool)
 }
 
-// getNamedRoutes returns the map where named routes are registered.
-func (r *Route) getNamedRoutes() map[string]*Route {
+// getNamedRoutes returns the map where named routes are registered and the
+// lock guarding it.
+func (r *Route) getNamedRoutes() (map[string]*Route, *sync.RWMutex) {
 	if r.parent == nil {
 		// During tests router is not always set.
 		r.parent = NewRouter()
@@ -477,6 +1141,49 @@ func (r *Route) getNamedRoutes() map[string]*Route {
 	return r.parent.getNamedRoutes()
 }
 
+// getPattern returns the named pattern registered in the parent router.
+func (r *Route) getPattern(name string) *namedPattern {
+	if r.parent == nil {
+		// During tests router is not always set.
+		r.parent = NewRouter()
+	}
+	return r.parent.getPattern(name)
+}
+
+// getCORS returns the CORS policy of the parent router.
+func (r *Route) getCORS() *CORSOptions {
+	if r.parent == nil {
+		return nil
+	}
+	return r.parent.getCORS()
+}
+
+// getNamePrefix returns the name prefix of the parent router.
+func (r *Route) getNamePrefix() string {
+	if r.parent == nil {
+		return ""
+	}
+	return r.parent.getNamePrefix()
+}
+
+// getMeta returns the metadata value for the given key set for the route or
+// its parents. The boolean is false if there's no such value.
+func (r *Route) getMeta(key interface{}) (interface{}, bool) {
+	if value, ok := r.meta[key]; ok {
+		return value, true
+	}
+	if r.parent == nil {
+		return nil, false
+	}
+	return r.parent.getMeta(key)
+}
+
+// getTrustProxyHeaders returns true if the parent router trusts the headers
+// set by reverse proxies.
+func (r *Route) getTrustProxyHeaders() bool {
+	return r.parent != nil && r.parent.getTrustProxyHeaders()
+}
+
 // getRegexpGroup returns regexp definitions from this route.
 func (r *Route) getRegexpGroup() *routeRegexpGroup {
 	if r.regexp == nil {
@@ -490,8 +1197,9 @@ func (r *Route) getRegexpGroup() *routeRegexpGroup {
 		} else {
 			// Copy.
 			r.regexp = &routeRegexpGroup{
-				host: regexp.host,
-				path: regexp.path,
+				host:    regexp.host,
+				path:    regexp.path,
+				queries: append([]*routeRegexp(nil), regexp.queries...),
 			}
 		}
 	}
@@ -0,0 +1,222 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// routeTable holds the routes of a router and their index.
+//
+// A table is never modified once stored in the router: changes store a new
+// table, so requests being matched keep using the table they got. The index
+// is built by the first request that needs it.
+type routeTable struct {
+	// Routes to be matched, in order.
+	routes []*Route
+	// Index to select candidate routes.
+	index *routeIndex
+	// Guards the index creation.
+	once sync.Once
+}
+
+// getIndex returns the index for the table routes, building it if needed.
+func (t *routeTable) getIndex(encoded bool) *routeIndex {
+	t.once.Do(func() {
+		t.index = newRouteIndex(t.routes, encoded)
+	})
+	return t.index
+}
+
+// getTable returns the current route table.
+func (r *Router) getTable() *routeTable {
+	if t, _ := r.table.Load().(*routeTable); t != nil {
+		return t
+	}
+	return new(routeTable)
+}
+
+// updateTable stores a new table with the routes returned by f, which
+// receives a copy of the current routes.
+func (r *Router) updateTable(f func([]*Route) []*Route) {
+	r.tableLock.Lock()
+	defer r.tableLock.Unlock()
+	routes := append([]*Route(nil), r.getTable().routes...)
+	r.table.Store(&routeTable{routes: f(routes)})
+}
+
+// appendRoute stores a new table with a route added to the current routes.
+// The routes are not copied: the new table shares them with the previous
+// one, which doesn't see the added route.
+func (r *Router) appendRoute(route *Route) {
+	r.tableLock.Lock()
+	defer r.tableLock.Unlock()
+	r.table.Store(&routeTable{routes: append(r.getTable().routes, route)})
+}
+
+// resetIndex discards the index when the matchers of the routes change.
+// The routes are not copied.
+func (r *Router) resetIndex() {
+	r.tableLock.Lock()
+	defer r.tableLock.Unlock()
+	r.table.Store(&routeTable{routes: r.getTable().routes})
+}
+
+// DetachedRoute returns an empty route for the router, without registering
+// it. Once the route is set, call Router.AddRoute() or Router.ReplaceRoute()
+// to start matching it.
+//
+// Routes must not be changed while they are used to match requests, so this
+// is the way to add or change routes while the router is serving requests:
+//
+//     route := r.DetachedRoute().Path("/plugins/foo").Handler(fooHandler)
+//     r.AddRoute(route)
+//
+// The route name isn't registered until the route is added, and neither are
+// the names of the routes of its subrouters.
+func (r *Router) DetachedRoute() *Route {
+	route := r.newRoute()
+	route.detached = true
+	return route
+}
+
+// AddRoute adds a route returned by Router.DetachedRoute() to the end of the
+// routes of the router.
+//
+// The routes can be changed while the router is serving requests: requests
+// being matched keep using the previous routes.
+func (r *Router) AddRoute(route *Route) error {
+	if route.parent != r || !route.detached {
+		return errors.New("mux: route is not a detached route of the router")
+	}
+	route.detached = false
+	r.updateTable(func(routes []*Route) []*Route {
+		return append(routes, route)
+	})
+	r.updateNames(nil, route)
+	return nil
+}
+
+// RemoveRoute removes a route from the router, with its subrouters. Names
+// of the removed routes are unregistered. It returns false if the route
+// isn't registered in the router.
+//
+// The routes can be changed while the router is serving requests: requests
+// being matched keep using the previous routes.
+func (r *Router) RemoveRoute(route *Route) bool {
+	removed := false
+	r.updateTable(func(routes []*Route) []*Route {
+		for k, v := range routes {
+			if v == route {
+				removed = true
+				return append(routes[:k], routes[k+1:]...)
+			}
+		}
+		return routes
+	})
+	if removed {
+		r.updateNames(route, nil)
+	}
+	return removed
+}
+
+// ReplaceRoute replaces a route of the router by a route returned by
+// Router.DetachedRoute(), in the same position. Names of the old route and
+// its subrouters are unregistered, and the ones of the new route are
+// registered.
+//
+// The routes can be changed while the router is serving requests: requests
+// being matched keep using the previous routes.
+func (r *Router) ReplaceRoute(old, route *Route) error {
+	if route.parent != r || !route.detached {
+		return errors.New("mux: route is not a detached route of the router")
+	}
+	replaced := false
+	r.updateTable(func(routes []*Route) []*Route {
+		for k, v := range routes {
+			if v == old {
+				routes[k] = route
+				replaced = true
+				break
+			}
+		}
+		return routes
+	})
+	if !replaced {
+		return errors.New("mux: route to replace is not registered in the router")
+	}
+	route.detached = false
+	r.updateNames(old, route)
+	return nil
+}
+
+// SetHandler replaces the handler of the route registered with the given
+// name, which is prefixed by the name prefix of the router. The route can
+// be registered in a subrouter.
+//
+// The handler is replaced atomically, so this can be done while the router
+// is serving requests: requests that matched the route already keep using
+// the previous handler.
+func (r *Router) SetHandler(name string, handler http.Handler) error {
+	route := r.Get(name)
+	if route == nil {
+		return fmt.Errorf("mux: route %q not found", name)
+	}
+	route.handler.Store(routeHandler{handler})
+	return nil
+}
+
+// updateNames unregisters the names of a removed route and registers the
+// ones of an added route, including the routes of their subrouters, in a
+// single step. Names taken by other routes are not unregistered. Any of the
+// routes can be nil.
+func (r *Router) updateNames(removed, added *Route) {
+	names, lock := r.getNamedRoutes()
+	lock.Lock()
+	defer lock.Unlock()
+	if removed != nil {
+		removed.walkRoutes(func(route *Route) {
+			if route.name != "" && names[route.name] == route {
+				delete(names, route.name)
+			}
+		})
+	}
+	if added != nil {
+		added.walkRoutes(func(route *Route) {
+			if route.name != "" {
+				names[route.name] = route
+			}
+		})
+	}
+}
+
+// isDetached returns true if the route, or the route of a router above it,
+// is a detached route that wasn't added yet.
+func (r *Route) isDetached() bool {
+	if r.detached {
+		return true
+	}
+	if router, ok := r.parent.(*Router); ok {
+		if route, ok := router.parent.(*Route); ok {
+			return route.isDetached()
+		}
+	}
+	return false
+}
+
+// walkRoutes calls f for the route and the routes of its subrouters.
+func (r *Route) walkRoutes(f func(*Route)) {
+	f(r)
+	for _, m := range r.matchers {
+		if sub, ok := m.(*Router); ok {
+			for _, route := range sub.getTable().routes {
+				route.walkRoutes(f)
+			}
+		}
+	}
+}
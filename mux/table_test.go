@@ -0,0 +1,128 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestRuntimeChanges(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	serve := func(r *Router, path string) string {
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		return res.Body.String()
+	}
+
+	r := NewRouter()
+	r.Handle("/a", handler("a")).Name("a")
+	s := r.PathPrefix("/sub").Subrouter().NamePrefix("sub.")
+	s.Handle("/b", handler("b")).Name("b")
+
+	// Detached routes are not matched until they are added.
+	c := r.DetachedRoute().Path("/c").Handler(handler("c")).Name("c")
+	if c.GetName() != "c" || r.Get("c") != nil || serve(r, "/c") != "404 page not found\n" {
+		t.Errorf("Expected detached route to be ignored")
+	}
+	if err := r.AddRoute(c); err != nil || r.Get("c") != c || serve(r, "/c") != "c" {
+		t.Errorf("Expected added route to match, got error %v", err)
+	}
+	if err := r.AddRoute(c); err == nil {
+		t.Errorf("Expected error adding a route twice")
+	}
+	if err := s.AddRoute(r.DetachedRoute()); err == nil {
+		t.Errorf("Expected error adding a route of another router")
+	}
+
+	// Names in subrouters of detached routes are registered when added.
+	table := r.getTable()
+	d := r.DetachedRoute().PathPrefix("/d")
+	d.Subrouter().Handle("/e", handler("e")).Name("e")
+	if r.getTable() != table || r.Get("e") != nil {
+		t.Errorf("Expected detached subrouter not to change the router")
+	}
+	if err := r.AddRoute(d); err != nil || r.Get("e") == nil || serve(r, "/d/e") != "e" {
+		t.Errorf("Expected added subrouter to match, got error %v", err)
+	}
+	r.RemoveRoute(d)
+
+	// Replacing routes and handlers.
+	if err := r.SetHandler("sub.b", handler("b2")); err != nil || serve(r, "/sub/b") != "b2" || s.Get("b") == nil {
+		t.Errorf("Expected new handler, got error %v", err)
+	}
+	if err := s.SetHandler("x", handler("x")); err == nil {
+		t.Errorf("Expected error for unknown route")
+	}
+	a := r.Get("a")
+	a2 := r.DetachedRoute().Path("/a2").Handler(handler("a2")).Name("a2")
+	if err := r.ReplaceRoute(a, a2); err != nil || r.Get("a") != nil || r.Get("a2") != a2 {
+		t.Errorf("Expected replaced route names to be updated, got error %v", err)
+	}
+	if serve(r, "/a") == "a" || serve(r, "/a2") != "a2" {
+		t.Errorf("Expected replaced route to match")
+	}
+	if routes := r.getTable().routes; len(routes) != 3 || routes[0] != a2 {
+		t.Errorf("Expected replaced route at the same position")
+	}
+	if err := r.ReplaceRoute(a, r.DetachedRoute()); err == nil {
+		t.Errorf("Expected error replacing a missing route")
+	}
+
+	// Removing routes with subrouters.
+	if !r.RemoveRoute(r.getTable().routes[1]) || r.Get("sub.b") != nil || serve(r, "/sub/b") == "b2" {
+		t.Errorf("Expected removed subrouter to be gone")
+	}
+	if r.RemoveRoute(a) {
+		t.Errorf("Expected false removing a missing route")
+	}
+	if err := r.SetHandler("c", handler("c2")); err != nil || r.Get("c") != c || serve(r, "/c") != "c2" {
+		t.Errorf("Expected the handler of the same route to be replaced, got error %v", err)
+	}
+	if !r.RemoveRoute(c) || serve(r, "/c") != "404 page not found\n" {
+		t.Errorf("Expected route to be removed after replacing its handler")
+	}
+}
+
+func TestRuntimeChangesConcurrency(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("/static", func(w http.ResponseWriter, req *http.Request) {}).Name("static")
+	var wg sync.WaitGroup
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				req, _ := http.NewRequest("GET", "http://localhost/static", nil)
+				var match RouteMatch
+				if !r.Match(req, &match) {
+					t.Errorf("Expected static route to match")
+					return
+				}
+				r.Get("static").URL()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		route := r.DetachedRoute().Path("/plugin").Name("plugin")
+		r.AddRoute(route)
+		r.SetHandler("static", http.NotFoundHandler())
+		r.RemoveRoute(route)
+	}
+	close(done)
+	wg.Wait()
+}
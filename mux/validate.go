@@ -0,0 +1,163 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks the routes of the router and its subrouters, and returns
+// the problems found, if any:
+//
+// - routes that have an error, e.g. because of an invalid template or
+// duplicated variable names. See Route.GetError();
+//
+// - route names used by more than one route: only the last one can be
+// retrieved by Router.Get();
+//
+// - routes redirecting to a route name that isn't registered. See
+// Route.RedirectTo();
+//
+// - routes that can never match because a route registered before them in
+// the same router matches all their requests, e.g. a path prefix or a
+// template with variables.
+//
+// Shadowed routes are only detected when the earlier route is simple enough
+// to prove it: it can only have host, path and method matchers, its host
+// template must be the same and its methods must include the ones of the
+// shadowed route. Validate is meant to be called in tests or at startup:
+//
+//     if errs := r.Validate(); errs != nil {
+//         log.Fatal(errs)
+//     }
+func (r *Router) Validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	r.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		if route.err != nil {
+			errs = append(errs, fmt.Errorf("mux: route %q has an error: %v",
+				route.Label(), route.err))
+		}
+		if route.name != "" {
+			if names[route.name] {
+				errs = append(errs, fmt.Errorf(
+					"mux: route name %q is used by more than one route",
+					route.name))
+			}
+			names[route.name] = true
+		}
+		if route.redirectTo != "" {
+			all, lock := r.getNamedRoutes()
+			lock.RLock()
+			target := all[route.redirectTo]
+			lock.RUnlock()
+			if target == nil {
+				errs = append(errs, fmt.Errorf(
+					"mux: route %q redirects to unknown route %q",
+					route.Label(), route.redirectTo))
+			}
+		}
+		for _, prev := range router.getTable().routes {
+			if prev == route {
+				break
+			}
+			if prev.shadows(route) {
+				errs = append(errs, fmt.Errorf(
+					"mux: route %q is shadowed by route %q, registered before it",
+					route.Label(), prev.Label()))
+				break
+			}
+		}
+		return nil
+	})
+	return errs
+}
+
+// shadows returns true if the route provably matches all requests matched
+// by route b, registered after it in the same router.
+func (r *Route) shadows(b *Route) bool {
+	if r.buildOnly || r.err != nil || b.buildOnly || b.err != nil {
+		return false
+	}
+	var methods methodMatcher
+	for _, m := range r.matchers {
+		switch m := m.(type) {
+		case *routeRegexp:
+			if m.regexpType == regexpTypeQuery {
+				return false
+			}
+		case methodMatcher:
+			methods = m
+		default:
+			return false
+		}
+	}
+	// Methods.
+	if methods != nil {
+		included := false
+		for _, m := range b.matchers {
+			if bm, ok := m.(methodMatcher); ok && containsAll(methods, bm) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	var host, path, bHost, bPath *routeRegexp
+	if r.regexp != nil {
+		host, path = r.regexp.host, r.regexp.path
+	}
+	if b.regexp != nil {
+		bHost, bPath = b.regexp.host, b.regexp.path
+	}
+	// Host.
+	if host != nil && (bHost == nil || host.template != bHost.template) {
+		return false
+	}
+	// Path. With the PathNotFound policy, strict slash routes only match
+	// their own form.
+	strict := path != nil && path.strictSlash && r.pathPolicy != PathNotFound
+	bStrict := bPath != nil && bPath.strictSlash && b.pathPolicy != PathNotFound
+	switch {
+	case path == nil:
+		return true
+	case bPath == nil || path.useEncodedPath != bPath.useEncodedPath:
+		return false
+	case path.template == bPath.template:
+		return (path.matchPrefix || !bPath.matchPrefix) && (strict || !bStrict)
+	case path.strictSlash && !strict:
+		// The regexp matches the other form, but the route doesn't.
+		return false
+	case path.matchPrefix && len(path.varsN) == 0:
+		return strings.HasPrefix(bPath.template, path.template)
+	case len(bPath.varsN) == 0 && !bPath.matchPrefix:
+		if !path.regexp.MatchString(bPath.template) {
+			return false
+		}
+		if bStrict {
+			// The other form is matched as well, to redirect.
+			other := bPath.template + "/"
+			if strings.HasSuffix(bPath.template, "/") {
+				other = bPath.template[:len(bPath.template)-1]
+			}
+			return path.regexp.MatchString(other)
+		}
+		return true
+	}
+	return false
+}
+
+// containsAll returns true if all values in b are in a.
+func containsAll(a, b []string) bool {
+	for _, v := range b {
+		if !matchInArray(a, v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	r := NewRouter()
+	r.Path("/users/{id}").Methods("GET", "PUT").Name("user")
+	r.Path("/users/new").Methods("GET").Name("user.new")
+	r.Path("/users/new").Methods("POST").Name("user.create")
+	r.Path("/users/{id:[0-9]+}").Name("user.numeric")
+	r.PathPrefix("/static").Name("static")
+	r.Path("/static/{file}").Name("static.file")
+	r.Path("/static2").Name("static2")
+	r.Host("www.domain.com").Path("/home").Name("www.home")
+	r.Path("/home").Name("home")
+	r.Host("api.domain.com").Path("/home").Name("api.home")
+	r.Path("/home").Queries("page", "{page}").Name("home.paged")
+	r.Path("/home").Name("home")
+	r.Path("/{a}/{a}").Name("duplicated")
+	r.Path("/items").Headers("X-Debug", "1").Name("items.debug")
+	r.Path("/items").Name("items")
+	r.MatcherFunc(func(*http.Request, *RouteMatch) bool { return true })
+	r.Path("/after").Name("after")
+	s := r.PathPrefix("/admin").Subrouter()
+	s.PathPrefix("/").Name("admin.all")
+	s.Path("/users").Name("admin.users")
+	r.Path("/admin/users").Name("admin.users.again")
+	st := r.PathPrefix("/strict").Subrouter().StrictSlash(true)
+	st.Path("/a").Name("strict.a")
+	st.Path("/{x:[a-z]}").Name("strict.x")
+	st.Path("/a/").Name("strict.a.slash")
+
+	expected := []string{
+		`mux: route "user.new" is shadowed by route "user", registered before it`,
+		`mux: route "static.file" is shadowed by route "static", registered before it`,
+		`mux: route "static2" is shadowed by route "static", registered before it`,
+		`mux: route "api.home" is shadowed by route "home", registered before it`,
+		`mux: route "home.paged" is shadowed by route "home", registered before it`,
+		`mux: route name "home" is used by more than one route`,
+		`mux: route "home" is shadowed by route "home", registered before it`,
+		`mux: route "unnamed route" has an error: mux: duplicated route variable "a"`,
+		`mux: route "admin.users" is shadowed by route "admin.all", registered before it`,
+		`mux: route "strict.a.slash" is shadowed by route "strict.a", registered before it`,
+	}
+	errs := r.Validate()
+	if len(errs) != len(expected) {
+		t.Errorf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if i < len(expected) && err.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], err.Error())
+		}
+	}
+
+	r = NewRouter()
+	r.Path("/a").Name("a")
+	r.Path("/b").Name("b")
+	if errs := r.Validate(); errs != nil {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}